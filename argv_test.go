@@ -0,0 +1,165 @@
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	yup "github.com/yupsh/framework"
+	"github.com/yupsh/framework/opt"
+)
+
+// Switch types in the style of a command's opt package
+type numberFlag bool
+type lineCount int
+
+type numberedFlags struct {
+	Number   numberFlag    `flag:"n" usage:"number all output lines"`
+	Lines    lineCount     `flag:"l,lines"`
+	Squeeze  bool          `flag:"s,squeeze-blank"`
+	Pattern  []string      `flag:"e,regexp"`
+	Timeout  time.Duration `flag:"t"`
+	Tabs     bool          `flag:"T,show-tabs"`
+	TabWidth uint          `flag:"tab-width"`
+}
+
+func (f numberFlag) Configure(flags *numberedFlags) { flags.Number = f }
+func (n lineCount) Configure(flags *numberedFlags)  { flags.Lines = n * 10 }
+
+func TestParseArgv(t *testing.T) {
+	tests := []struct {
+		argv           []string
+		wantFlags      numberedFlags
+		wantPositional []string
+	}{
+		{nil, numberedFlags{}, nil},
+		{[]string{"-n", "a.txt"}, numberedFlags{Number: true}, []string{"a.txt"}},
+		{[]string{"-ns", "a", "-", "b"}, numberedFlags{Number: true, Squeeze: true}, []string{"a", "-", "b"}},
+		{[]string{"a", "--squeeze-blank", "b"}, numberedFlags{Squeeze: true}, []string{"a", "b"}},
+		{[]string{"--lines=5"}, numberedFlags{Lines: 50}, nil},
+		{[]string{"--lines", "5"}, numberedFlags{Lines: 50}, nil},
+		{[]string{"-l5"}, numberedFlags{Lines: 50}, nil},
+		{[]string{"-nl", "5"}, numberedFlags{Number: true, Lines: 50}, nil},
+		{[]string{"--li=2", "--squeeze"}, numberedFlags{Lines: 20, Squeeze: true}, nil},
+		{[]string{"-e", "a", "--regexp=b", "-eb c"}, numberedFlags{Pattern: []string{"a", "b", "b c"}}, nil},
+		{[]string{"-t", "1m30s", "--tab-width", "4"}, numberedFlags{Timeout: 90 * time.Second, TabWidth: 4}, nil},
+		{[]string{"-n", "--", "-s", "--lines"}, numberedFlags{Number: true}, []string{"-s", "--lines"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.argv, " "), func(t *testing.T) {
+			inputs, err := opt.ParseArgv[numberedFlags]("cat", tt.argv)
+			if err != nil {
+				t.Fatalf("ParseArgv() error = %v", err)
+			}
+			if got, want := fmt.Sprintf("%+v", inputs.Flags), fmt.Sprintf("%+v", tt.wantFlags); got != want {
+				t.Errorf("Flags = %s, want %s", got, want)
+			}
+			if got, want := fmt.Sprintf("%q", inputs.Positional), fmt.Sprintf("%q", tt.wantPositional); got != want {
+				t.Errorf("Positional = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestParseArgvErrors(t *testing.T) {
+	tests := []struct {
+		argv []string
+		want string
+	}{
+		{[]string{"-x"}, "cat: invalid option -- 'x'"},
+		{[]string{"-nx"}, "cat: invalid option -- 'x'"},
+		{[]string{"--bogus"}, "cat: unrecognized option '--bogus'"},
+		{[]string{"--t"}, "cat: option '--t' is ambiguous; possibilities: '--timeout' '--tab-width'"},
+		{[]string{"-l"}, "cat: option requires an argument -- 'l'"},
+		{[]string{"--lines"}, "cat: option '--lines' requires an argument"},
+		{[]string{"--squeeze-blank=yes"}, "cat: option '--squeeze-blank' doesn't allow an argument"},
+		{[]string{"-l", "ten"}, "cat: invalid argument 'ten' for '-l'"},
+		{[]string{"--tab-width=-1"}, "cat: invalid argument '-1' for '--tab-width'"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.argv, " "), func(t *testing.T) {
+			_, err := opt.ParseArgv[numberedFlags]("cat", tt.argv)
+			var usageErr *opt.UsageError
+			if !errors.As(err, &usageErr) {
+				t.Fatalf("ParseArgv() error = %v, want a UsageError", err)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("ParseArgv() error = %q, want %q", err, tt.want)
+			}
+			if got := usageErr.Hint(); got != "Try 'cat --help' for more information." {
+				t.Errorf("Hint() = %q", got)
+			}
+		})
+	}
+
+	if _, err := opt.ParseArgv[numberedFlags]("cat", []string{"-n", "--help"}); !errors.Is(err, opt.ErrHelp) {
+		t.Errorf("ParseArgv(--help) error = %v, want ErrHelp", err)
+	}
+}
+
+type searchCommand struct {
+	yup.StandardCommand[searchFlags]
+}
+
+func (searchCommand) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	return nil
+}
+
+func TestRegistryParsesArgv(t *testing.T) {
+	registry := yup.NewRegistry()
+	registry.Register(yup.Spec{
+		Name: "search",
+		New: func(parameters ...any) yup.Command {
+			args := opt.Args[string, searchFlags](parameters...)
+			return searchCommand{yup.StandardCommand[searchFlags]{Name: "search", Positional: args.Positional, Flags: args.Flags}}
+		},
+		Synopsis: "Search for PATTERN in each FILE.",
+		Args:     "PATTERN [FILE]...",
+		Flags:    opt.FlagsOf[searchFlags](),
+		Argv:     opt.Argv[searchFlags],
+	})
+
+	cmd, err := yup.Parse(context.Background(), "search -im3 foo --label=in a.txt", registry)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got, want := yup.Describe(cmd), "search --ignore-case --max-count=3 --label=in foo a.txt"; got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		src        string
+		wantStatus int
+		wantStdout string
+		wantStderr string
+	}{
+		{"search -q foo", yup.StatusUsage, "", "search: invalid option -- 'q'\nTry 'search --help' for more information.\n"},
+		{"search --help", yup.StatusSuccess, "Usage: search [OPTION]... PATTERN [FILE]...\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			cmd, err := yup.Parse(context.Background(), tt.src, registry)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := yup.Describe(cmd); got != tt.src {
+				t.Errorf("Describe() = %q, want %q", got, tt.src)
+			}
+			var stdout, stderr strings.Builder
+			err = cmd.Execute(context.Background(), strings.NewReader(""), &stdout, &stderr)
+			if got := yup.ExitStatus(err); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+			if !strings.HasPrefix(stdout.String(), tt.wantStdout) {
+				t.Errorf("stdout = %q, want prefix %q", stdout.String(), tt.wantStdout)
+			}
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package yup
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultBufferSize is the ring size used between stages in buffered mode
+// when no BufferSize flag is given
+const DefaultBufferSize = 64 * 1024
+
+// pipeReader and pipeWriter are the two ends of a connection between
+// stages; *io.PipeReader and *io.PipeWriter satisfy them
+type pipeReader interface {
+	io.ReadCloser
+	CloseWithError(err error) error
+}
+
+type pipeWriter interface {
+	io.WriteCloser
+	CloseWithError(err error) error
+}
+
+// newPipe connects two stages according to the execution flags
+func newPipe(flags ExecutionFlags) (pipeReader, pipeWriter) {
+	if !flags.Buffered {
+		return io.Pipe()
+	}
+	p := newRingPipe(flags.BufferSize, flags.Spill)
+	return ringPipeReader{p}, ringPipeWriter{p}
+}
+
+func newRingPipe(size int, spill bool) *ringPipe {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	p := &ringPipe{buf: make([]byte, size), spill: spill}
+	p.cond.L = &p.mu
+	return p
+}
+
+// ringPipe is an in-memory pipe backed by a bounded ring buffer. Writes
+// only block when the ring is full; with spilling enabled they overflow to
+// a temporary file instead, and the reader drains the ring before the file
+// so byte order is preserved.
+type ringPipe struct {
+	mu   sync.Mutex
+	cond sync.Cond
+
+	buf   []byte
+	start int // index of the first unread byte in buf
+	count int // number of unread bytes in buf
+
+	spill     bool
+	file      *os.File // overflow, created on first use
+	fileRead  int64
+	fileWrite int64
+
+	werr error // set once the write end is closed
+	rerr error // set once the read end is closed
+}
+
+func (p *ringPipe) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if p.rerr != nil {
+			return 0, io.ErrClosedPipe
+		}
+		if p.count > 0 {
+			n := p.readRing(b)
+			p.cond.Broadcast()
+			return n, nil
+		}
+		if p.fileRead < p.fileWrite {
+			return p.readFile(b)
+		}
+		if p.werr != nil {
+			return 0, p.werr
+		}
+		p.cond.Wait()
+	}
+}
+
+func (p *ringPipe) readRing(b []byte) int {
+	n := 0
+	for n < len(b) && p.count > 0 {
+		end := p.start + p.count
+		if end > len(p.buf) {
+			end = len(p.buf)
+		}
+		c := copy(b[n:], p.buf[p.start:end])
+		n += c
+		p.start = (p.start + c) % len(p.buf)
+		p.count -= c
+	}
+	if p.count == 0 {
+		p.start = 0
+	}
+	return n
+}
+
+func (p *ringPipe) readFile(b []byte) (int, error) {
+	if remaining := p.fileWrite - p.fileRead; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+	n, err := p.file.ReadAt(b, p.fileRead)
+	p.fileRead += int64(n)
+	if p.fileRead == p.fileWrite {
+		// Drained: reuse the file from the beginning next time
+		p.fileRead, p.fileWrite = 0, 0
+		if terr := p.file.Truncate(0); terr != nil && err == nil {
+			err = terr
+		}
+		p.cond.Broadcast()
+	}
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (p *ringPipe) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	written := 0
+	for len(b) > 0 {
+		if p.rerr != nil {
+			return written, p.rerr
+		}
+		if p.werr != nil {
+			return written, io.ErrClosedPipe
+		}
+
+		// Once data has overflowed, keep appending to the file until the
+		// reader catches up, otherwise bytes would be reordered
+		if p.fileWrite == 0 {
+			if free := len(p.buf) - p.count; free > 0 {
+				n := p.writeRing(b)
+				written += n
+				b = b[n:]
+				p.cond.Broadcast()
+				continue
+			}
+		}
+
+		if p.spill {
+			n, err := p.writeFile(b)
+			written += n
+			p.cond.Broadcast()
+			return written, err
+		}
+
+		p.cond.Wait()
+	}
+	return written, nil
+}
+
+// tryWrite writes all of b if it fits in the ring right now and reports
+// whether it did; it never blocks and never spills
+func (p *ringPipe) tryWrite(b []byte) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rerr != nil {
+		return false, p.rerr
+	}
+	if p.werr != nil {
+		return false, io.ErrClosedPipe
+	}
+	if p.fileWrite > 0 || len(p.buf)-p.count < len(b) {
+		return false, nil
+	}
+	p.writeRing(b)
+	p.cond.Broadcast()
+	return true, nil
+}
+
+func (p *ringPipe) writeRing(b []byte) int {
+	n := 0
+	for n < len(b) && p.count < len(p.buf) {
+		end := (p.start + p.count) % len(p.buf)
+		limit := len(p.buf)
+		if end < p.start {
+			limit = p.start
+		}
+		c := copy(p.buf[end:limit], b[n:])
+		n += c
+		p.count += c
+	}
+	return n
+}
+
+func (p *ringPipe) writeFile(b []byte) (int, error) {
+	if p.file == nil {
+		f, err := os.CreateTemp("", "yup-pipe-*")
+		if err != nil {
+			return 0, err
+		}
+		p.file = f
+	}
+	n, err := p.file.WriteAt(b, p.fileWrite)
+	p.fileWrite += int64(n)
+	return n, err
+}
+
+func (p *ringPipe) closeWrite(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		err = io.EOF
+	}
+	if p.werr == nil {
+		p.werr = err
+	}
+	p.cond.Broadcast()
+}
+
+func (p *ringPipe) closeRead(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	if p.rerr == nil {
+		p.rerr = err
+	}
+	p.count = 0
+	if p.file != nil {
+		_ = p.file.Close()
+		_ = os.Remove(p.file.Name())
+		p.file = nil
+		p.fileRead, p.fileWrite = 0, 0
+	}
+	p.cond.Broadcast()
+}
+
+type ringPipeReader struct{ p *ringPipe }
+
+func (r ringPipeReader) Read(b []byte) (int, error) { return r.p.read(b) }
+func (r ringPipeReader) Close() error               { return r.CloseWithError(nil) }
+func (r ringPipeReader) CloseWithError(err error) error {
+	r.p.closeRead(err)
+	return nil
+}
+
+type ringPipeWriter struct{ p *ringPipe }
+
+func (w ringPipeWriter) Write(b []byte) (int, error) { return w.p.write(b) }
+func (w ringPipeWriter) Close() error                { return w.CloseWithError(nil) }
+func (w ringPipeWriter) CloseWithError(err error) error {
+	w.p.closeWrite(err)
+	return nil
+}
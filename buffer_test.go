@@ -0,0 +1,64 @@
+package yup_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	yup "github.com/yupsh/framework"
+)
+
+func TestBufferedPipeline(t *testing.T) {
+	input := strings.Repeat("0123456789abcdef\n", 4096)
+
+	t.Run("preserves byte order", func(t *testing.T) {
+		var output bytes.Buffer
+		err := yup.Pipe(passthrough, passthrough, passthrough).
+			WithFlags(yup.Buffered, yup.BufferSize(100)).
+			Execute(context.Background(), strings.NewReader(input), &output, io.Discard)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if output.String() != input {
+			t.Errorf("Output differs from input (%d vs %d bytes)", output.Len(), len(input))
+		}
+	})
+
+	t.Run("spills when the consumer lags", func(t *testing.T) {
+		produced := make(chan struct{})
+		producer := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			defer close(produced)
+			_, err := io.Copy(stdout, stdin)
+			return err
+		})
+		consumer := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			// Only start reading once the producer has written everything
+			<-produced
+			_, err := io.Copy(stdout, stdin)
+			return err
+		})
+
+		var output bytes.Buffer
+		done := make(chan error, 1)
+		go func() {
+			done <- yup.Pipe(producer, consumer).
+				WithFlags(yup.Buffered, yup.BufferSize(1024), yup.Spill).
+				Execute(context.Background(), strings.NewReader(input), &output, io.Discard)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Producer blocked on a full buffer despite spilling")
+		}
+		if output.String() != input {
+			t.Errorf("Output differs from input (%d vs %d bytes)", output.Len(), len(input))
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package yup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+)
+
+// sniffSize is how much input Decompress looks at to recognise zlib, whose
+// two-byte header alone would match some text
+const sniffSize = 512
+
+// Decompress returns a reader of r's content, decompressed if it starts
+// with the magic bytes of gzip, zlib or bzip2 and unchanged otherwise.
+// Concatenated gzip members and bzip2 streams are read one after another,
+// as zcat and bzcat do. It waits for no more input than the magic bytes
+// need, so text arriving slowly through a pipe is passed on as it comes;
+// only input starting with a zlib header is read further ahead.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := peek(br, 1)
+	if err != nil {
+		return nil, err
+	}
+	// No magic bytes start otherwise
+	if len(head) == 0 || head[0] != 0x1f && head[0] != 'B' && head[0]&0x0f != 8 {
+		return br, nil
+	}
+	if head, err = peek(br, 2); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(head, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.Equal(head, []byte("BZ")):
+		if head, err = peek(br, 3); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(head, []byte("BZh")) {
+			break
+		}
+		if head, err = peek(br, 4); err != nil {
+			return nil, err
+		}
+		if len(head) == 4 && head[3] >= '1' && head[3] <= '9' {
+			return bzip2.NewReader(br), nil
+		}
+	case isZlibHeader(head):
+		if head, err = peek(br, sniffSize); err != nil {
+			return nil, err
+		}
+		if isZlib(head) {
+			return zlib.NewReader(br)
+		}
+	}
+	return br, nil
+}
+
+// peek returns the next n bytes br will read, fewer only at the end of
+// input
+func peek(br *bufio.Reader, n int) ([]byte, error) {
+	head, err := br.Peek(n)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return head, nil
+}
+
+// isZlibHeader reports whether head is a valid two-byte zlib header
+func isZlibHeader(head []byte) bool {
+	return len(head) == 2 && head[0]&0x0f == 8 && head[0]>>4 <= 7 && head[1]&0x20 == 0 &&
+		(uint16(head[0])<<8|uint16(head[1]))%31 == 0
+}
+
+// isZlib reports whether head is the start of a zlib stream: a valid
+// header, checked by trying to inflate what follows
+func isZlib(head []byte) bool {
+	if len(head) < 2 || !isZlibHeader(head[:2]) {
+		return false
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(head))
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(io.Discard, zr)
+	return err == nil || err == io.ErrUnexpectedEOF
+}
@@ -0,0 +1,131 @@
+package yup_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	yup "github.com/yupsh/framework"
+)
+
+// bzipped is "hello\n" compressed by bzip2(1), which has no Go writer
+var bzipped = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xc1, 0xc0,
+	0x80, 0xe2, 0x00, 0x00, 0x01, 0x41, 0x00, 0x00, 0x10, 0x02, 0x44, 0xa0,
+	0x00, 0x30, 0xcd, 0x00, 0xc3, 0x46, 0x29, 0x97, 0x17, 0x72, 0x45, 0x38,
+	0x50, 0x90, 0xc1, 0xc0, 0x80, 0xe2,
+}
+
+func gzipped(members ...string) []byte {
+	var buf bytes.Buffer
+	for _, member := range members {
+		w := gzip.NewWriter(&buf)
+		_, _ = io.WriteString(w, member)
+		_ = w.Close()
+	}
+	return buf.Bytes()
+}
+
+func zlibbed(s string) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = io.WriteString(w, s)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"gzip", gzipped("hello\n"), "hello\n"},
+		{"concatenated gzip", gzipped("hello\n", "world\n"), "hello\nworld\n"},
+		{"zlib", zlibbed("hello\n"), "hello\n"},
+		{"long zlib", zlibbed(strings.Repeat("hello\n", 1000)), strings.Repeat("hello\n", 1000)},
+		{"bzip2", bzipped, "hello\n"},
+		{"concatenated bzip2", append(append([]byte(nil), bzipped...), bzipped...), "hello\nhello\n"},
+		{"plain text", []byte("hello\n"), "hello\n"},
+		{"text like a zlib header", []byte("x^2 + y^2\n"), "x^2 + y^2\n"},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := yup.Decompress(bytes.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("Got %q, err %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecompressPipe(t *testing.T) {
+	// A writer still running must not stall plain text behind a full sniff
+	for _, input := range []string{"hello\n", "BZ\n", "a"} {
+		r, w := io.Pipe()
+		go func() { _, _ = io.WriteString(w, input) }()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			decompressed, err := yup.Decompress(r)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			buf := make([]byte, len(input))
+			if _, err := io.ReadFull(decompressed, buf); err != nil || string(buf) != input {
+				t.Errorf("Got %q, err %v, want %q", buf, err, input)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Decompress(%q) waited for more input", input)
+		}
+		_ = w.Close()
+	}
+}
+
+func TestProcessFilesDecompress(t *testing.T) {
+	corrupt := gzipped("hello\n")
+	corrupt[len(corrupt)-5] ^= 0xff // break the checksum
+
+	ctx := yup.WithFS(context.Background(), fstest.MapFS{
+		"a.gz":       {Data: gzipped("a\n")},
+		"b.txt":      {Data: []byte("b\n")},
+		"c.bz2":      {Data: bzipped},
+		"corrupt.gz": {Data: corrupt},
+	})
+	run := func(args []string, stdin io.Reader) (string, string) {
+		var output, stderr strings.Builder
+		options := yup.FileProcessorOptions{CommandName: "zcat", Decompress: true, ContinueOnError: true}
+		_ = yup.ProcessFilesWithContext(ctx, args, stdin, &output, &stderr, options,
+			func(ctx context.Context, source yup.InputSource, output io.Writer) error {
+				_, err := io.Copy(output, source.Reader)
+				return err
+			})
+		return output.String(), stderr.String()
+	}
+
+	if output, stderr := run([]string{"a.gz", "b.txt", "c.bz2"}, nil); output != "a\nb\nhello\n" || stderr != "" {
+		t.Errorf("Got %q, stderr %q", output, stderr)
+	}
+	if output, stderr := run(nil, bytes.NewReader(gzipped("stdin\n"))); output != "stdin\n" || stderr != "" {
+		t.Errorf("Got %q from stdin, stderr %q", output, stderr)
+	}
+	if _, stderr := run([]string{"corrupt.gz", "-"}, bytes.NewReader(gzipped("x\n"))); stderr != "zcat: corrupt.gz: gzip: invalid checksum\n" {
+		t.Errorf("Got stderr %q", stderr)
+	}
+}
@@ -0,0 +1,118 @@
+package yup
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/yupsh/framework/opt"
+)
+
+// Describer is implemented by commands that can render themselves as an
+// equivalent shell command line, e.g. for DryRun and Verbose output
+type Describer interface {
+	Describe() string
+}
+
+// Describe renders cmd as a shell command line. Commands that do not
+// implement Describer are named after the package that defines them, which
+// matches the one-command-per-module layout of yupsh.
+func Describe(cmd Command) string {
+	if d, ok := cmd.(Describer); ok {
+		return d.Describe()
+	}
+	t := reflect.TypeOf(cmd)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && t.PkgPath() != "" {
+		return path.Base(t.PkgPath())
+	}
+	return fmt.Sprintf("%T", cmd)
+}
+
+// Describe renders the pipeline as its stages joined with pipes
+func (p *Pipeline) Describe() string {
+	stages := make([]string, len(p.commands))
+	for i, cmd := range p.commands {
+		stages[i] = describeStage(cmd)
+	}
+	return strings.Join(stages, " | ")
+}
+
+// Describe reconstructs the command line from the command's name, flags and
+// positional arguments. Flags are rendered in long form from the fields of
+// F, named as opt.FlagsFor describes them: true booleans as --name, other
+// non-zero values as --name=value. Positionals follow a -- when any of them
+// would otherwise read as an option.
+func (c StandardCommand[F]) Describe() string {
+	words := []string{QuoteWord(c.Name)}
+	words = append(words, describeFlags(reflect.ValueOf(c.Flags))...)
+
+	for _, arg := range c.Positional {
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			words = append(words, "--")
+			break
+		}
+	}
+	for _, arg := range c.Positional {
+		words = append(words, QuoteWord(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// describeFlags renders the non-zero fields of a flags struct under their
+// long option names
+func describeFlags(v reflect.Value) []string {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var words []string
+	for _, flag := range opt.FlagsFor(v.Type()) {
+		value := v.Field(flag.Index)
+		if value.IsZero() {
+			continue
+		}
+		name := "--" + flag.Long
+		if flag.IsBool() {
+			words = append(words, name)
+			continue
+		}
+		words = append(words, name+"="+QuoteWord(fmt.Sprint(value.Interface())))
+	}
+	return words
+}
+
+// QuoteWord quotes s so that a POSIX shell reads it back as a single word
+func QuoteWord(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !isShellSafe(r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func isShellSafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("-_./:,+@%", r)
+}
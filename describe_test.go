@@ -0,0 +1,73 @@
+package yup_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+)
+
+type grepFlags struct {
+	IgnoreCase bool
+	MaxCount   int
+	Label      string
+}
+
+type grepCommand struct {
+	yup.StandardCommand[grepFlags]
+}
+
+func (c grepCommand) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	panic("not executed in these tests")
+}
+
+func ExampleDescribe() {
+	grep := grepCommand{yup.StandardCommand[grepFlags]{
+		Name:       "grep",
+		Positional: []string{"-v", "it's here"},
+		Flags:      grepFlags{IgnoreCase: true, MaxCount: 5, Label: "my file"},
+	}}
+	wc := grepCommand{yup.StandardCommand[grepFlags]{Name: "wc"}}
+
+	fmt.Println(yup.Describe(yup.Pipe(grep, wc)))
+	// Output:
+	// grep --ignore-case --max-count=5 --label='my file' -- -v 'it'\''s here' | wc
+}
+
+func TestDryRun(t *testing.T) {
+	cat := grepCommand{yup.StandardCommand[grepFlags]{Name: "cat", Positional: []string{"a.txt"}}}
+	wc := grepCommand{yup.StandardCommand[grepFlags]{Name: "wc"}}
+
+	var stdout, stderr strings.Builder
+	err := yup.Pipe(cat, wc).WithFlags(yup.DryRun).
+		Execute(context.Background(), strings.NewReader(""), &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no output, got %q", stdout.String())
+	}
+	if want := "cat a.txt | wc\n"; stderr.String() != want {
+		t.Errorf("Expected %q on stderr, got %q", want, stderr.String())
+	}
+}
+
+func TestDescribeSeparator(t *testing.T) {
+	tests := []struct {
+		positional []string
+		want       string
+	}{
+		{[]string{"foo", "-"}, "grep foo -"},
+		{[]string{"foo", "-v"}, "grep -- foo -v"},
+		{[]string{"-e", "a.txt"}, "grep -- -e a.txt"},
+	}
+	for _, tt := range tests {
+		grep := grepCommand{yup.StandardCommand[grepFlags]{Name: "grep", Positional: tt.positional}}
+		if got := yup.Describe(grep); got != tt.want {
+			t.Errorf("Describe(%q) = %q, want %q", tt.positional, got, tt.want)
+		}
+	}
+}
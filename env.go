@@ -0,0 +1,159 @@
+package yup
+
+import (
+	"context"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultUmask is the umask ProcessEnv starts with
+const DefaultUmask fs.FileMode = 0o022
+
+// Env is the environment a command executes in: its variables, working
+// directory and umask. Attached to a context with WithEnv, it lets
+// concurrent pipelines in one process each have their own, where the
+// process-wide os.Getenv and os.Getwd would be shared. Treat an Env as
+// immutable once attached and derive changed copies with Clone.
+type Env struct {
+	Vars   map[string]string // Environment variables, passed on to external commands
+	Locals map[string]string // Shell variables, visible to expansion but not exported
+	Dir    string            // Working directory that relative paths resolve against
+	Umask  fs.FileMode       // Permission bits cleared from files created by redirections
+}
+
+// ProcessEnv returns an Env holding a snapshot of the process's
+// environment variables and working directory
+func ProcessEnv() *Env {
+	env := &Env{Vars: map[string]string{}, Locals: map[string]string{}, Umask: DefaultUmask}
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			env.Vars[name] = value
+		}
+	}
+	env.Dir, _ = os.Getwd()
+	return env
+}
+
+// Clone returns a copy of the Env that can be changed independently
+func (e *Env) Clone() *Env {
+	clone := *e
+	clone.Vars, clone.Locals = map[string]string{}, map[string]string{}
+	maps.Copy(clone.Vars, e.Vars)
+	maps.Copy(clone.Locals, e.Locals)
+	return &clone
+}
+
+// Lookup returns the value of a shell or environment variable, with shell
+// variables taking precedence
+func (e *Env) Lookup(name string) (string, bool) {
+	if value, ok := e.Locals[name]; ok {
+		return value, true
+	}
+	value, ok := e.Vars[name]
+	return value, ok
+}
+
+// Environ returns the environment variables as sorted "name=value" strings,
+// the form os/exec expects
+func (e *Env) Environ() []string {
+	environ := make([]string, 0, len(e.Vars))
+	for name, value := range e.Vars {
+		environ = append(environ, name+"="+value)
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// Path resolves name against the working directory
+func (e *Env) Path(name string) string {
+	if e.Dir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(e.Dir, name)
+}
+
+type envKey struct{}
+
+// WithEnv returns a context whose commands execute in env
+func WithEnv(ctx context.Context, env *Env) context.Context {
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// EnvFrom returns the Env installed with WithEnv, or nil when commands use
+// the process environment. Under a Shell it is the shell's Env as it was
+// when the running command started.
+func EnvFrom(ctx context.Context) *Env {
+	switch env := ctx.Value(envKey{}).(type) {
+	case *Env:
+		return env
+	case liveEnv:
+		return env.env()
+	}
+	return nil
+}
+
+// liveEnv is an Env that commands can replace, such as a shell's
+type liveEnv interface {
+	env() *Env
+	setEnv(env *Env)
+}
+
+// withLiveEnv returns a context whose Env is looked up in env, so that
+// each command started with it sees the changes of those before it
+func withLiveEnv(ctx context.Context, env liveEnv) context.Context {
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// startEnv fixes the Env of ctx for a command starting now
+func startEnv(ctx context.Context) context.Context {
+	if _, live := ctx.Value(envKey{}).(liveEnv); live {
+		return WithEnv(ctx, EnvFrom(ctx))
+	}
+	return ctx
+}
+
+// LookupVar returns the value of a variable in ctx's Env, falling back to
+// the process environment
+func LookupVar(ctx context.Context, name string) (string, bool) {
+	if env := EnvFrom(ctx); env != nil {
+		return env.Lookup(name)
+	}
+	return os.LookupEnv(name)
+}
+
+// Getenv returns the value of a variable in ctx's Env, or "" if unset
+func Getenv(ctx context.Context, name string) string {
+	value, _ := LookupVar(ctx, name)
+	return value
+}
+
+// Getwd returns the working directory of ctx's Env, falling back to the
+// process working directory
+func Getwd(ctx context.Context) string {
+	if env := EnvFrom(ctx); env != nil && env.Dir != "" {
+		return env.Dir
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// ResolvePath resolves a relative path against ctx's working directory.
+// Without an Env the path is returned unchanged, for the process to resolve.
+func ResolvePath(ctx context.Context, name string) string {
+	if env := EnvFrom(ctx); env != nil {
+		return env.Path(name)
+	}
+	return name
+}
+
+// umask returns the permission bits to clear from files created in ctx
+func umask(ctx context.Context) fs.FileMode {
+	if env := EnvFrom(ctx); env != nil {
+		return env.Umask
+	}
+	return 0
+}
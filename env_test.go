@@ -0,0 +1,130 @@
+package yup_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+)
+
+func TestEnvPaths(t *testing.T) {
+	// Two pipelines running at once, each in its own directory
+	dirs := []string{t.TempDir(), t.TempDir()}
+	for i, dir := range dirs {
+		if err := os.WriteFile(filepath.Join(dir, "f.txt"), []byte{'a' + byte(i)}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	got := make([]string, len(dirs))
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := yup.WithEnv(context.Background(), &yup.Env{Dir: dir})
+			var out strings.Builder
+			err := yup.ProcessFilesWithContext(ctx, []string{"f.txt"}, nil, &out, io.Discard, yup.FileProcessorOptions{},
+				func(ctx context.Context, source yup.InputSource, output io.Writer) error {
+					_, err := io.Copy(output, source.Reader)
+					return err
+				})
+			if err != nil {
+				t.Error(err)
+			}
+			got[i] = out.String()
+		}()
+	}
+	wg.Wait()
+	if got[0] != "a" || got[1] != "b" {
+		t.Errorf("Got %q, want [a b]", got)
+	}
+
+	t.Run("missing file keeps its name", func(t *testing.T) {
+		ctx := yup.WithEnv(context.Background(), &yup.Env{Dir: dirs[0]})
+		_, err := yup.CollectInputSourcesWithContext(ctx, []string{"nosuch"}, nil)
+		if err == nil || strings.Contains(err.Error(), dirs[0]) {
+			t.Errorf("Got %v, want an error naming only nosuch", err)
+		}
+	})
+
+	t.Run("redirection", func(t *testing.T) {
+		ctx := yup.WithEnv(context.Background(), &yup.Env{Dir: dirs[0], Umask: 0o077})
+		cmd := yup.Redirect(chatty, yup.StdinFrom("f.txt"), yup.StdoutTo("out.txt"))
+		if err := cmd.Execute(ctx, nil, io.Discard, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(dirs[0], "out.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+			t.Errorf("Got mode %v, want 0600", info.Mode().Perm())
+		}
+	})
+
+	t.Run("zero umask", func(t *testing.T) {
+		root, err := os.OpenRoot(dirs[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer root.Close()
+		fsys := &permFS{WriteFS: yup.RootFS(root)}
+		ctx := yup.WithEnv(yup.WithFS(context.Background(), fsys), &yup.Env{})
+		cmd := yup.Redirect(chatty, yup.StdinFrom("f.txt"), yup.StdoutTo("out.txt"))
+		if err := cmd.Execute(ctx, nil, io.Discard, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if fsys.perm != 0o666 {
+			t.Errorf("Got mode %v, want 0666", fsys.perm)
+		}
+	})
+}
+
+// permFS records the permissions files are created with
+type permFS struct {
+	yup.WriteFS
+	perm fs.FileMode
+}
+
+func (p *permFS) OpenFile(name string, flag int, perm fs.FileMode) (yup.WritableFile, error) {
+	p.perm = perm
+	return p.WriteFS.OpenFile(name, flag, perm)
+}
+
+func TestEnvLookup(t *testing.T) {
+	env := &yup.Env{Vars: map[string]string{"A": "var", "B": "var"}, Locals: map[string]string{"B": "local"}}
+	ctx := yup.WithEnv(context.Background(), env)
+
+	if got := yup.Getenv(ctx, "A") + " " + yup.Getenv(ctx, "B"); got != "var local" {
+		t.Errorf("Getenv = %q", got)
+	}
+	if _, ok := yup.LookupVar(ctx, "PATH"); ok {
+		t.Error("LookupVar fell back to the process environment")
+	}
+	if got := env.Environ(); strings.Join(got, " ") != "A=var B=var" {
+		t.Errorf("Environ() = %q", got)
+	}
+
+	clone := env.Clone()
+	clone.Vars["A"] = "changed"
+	if env.Vars["A"] != "var" {
+		t.Error("Clone shares its variables")
+	}
+
+	cmd, err := yup.Parse(ctx, "echo $A ${B}x", yup.Commands{"echo": argv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := cmd.Execute(ctx, nil, &out, io.Discard); err != nil || out.String() != "var\nlocalx\n" {
+		t.Errorf("Got %q, err %v", out.String(), err)
+	}
+}
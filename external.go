@@ -0,0 +1,396 @@
+package yup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yupsh/framework/opt"
+)
+
+// DefaultGracePeriod is how long an external command has to exit after
+// SIGTERM before it is killed
+const DefaultGracePeriod = 5 * time.Second
+
+// ExternalFlags controls how an external executable is run
+type ExternalFlags struct {
+	GracePeriod time.Duration // Time between SIGTERM and SIGKILL on cancellation
+}
+
+// GracePeriod sets how long a cancelled external command may take to exit
+// before it is killed
+type GracePeriod time.Duration
+
+func (g GracePeriod) Configure(flags *ExternalFlags) { flags.GracePeriod = time.Duration(g) }
+
+// external runs an executable from the host system
+type external struct {
+	name  string
+	args  []string
+	flags ExternalFlags
+}
+
+// External creates a command that runs the named executable with string
+// arguments, so system tools can be mixed with native commands in one
+// pipeline. The process gets its own process group, which is sent SIGTERM
+// and then SIGKILL when the context is cancelled. In a Shell's foreground
+// job it stays in the shell's group instead, which owns the terminal, so
+// programs like vi and less can use it; only the process is signalled then.
+func External(name string, parameters ...any) Command {
+	args := opt.Args[string, ExternalFlags](parameters...)
+	flags := args.Flags
+	if flags.GracePeriod <= 0 {
+		flags.GracePeriod = DefaultGracePeriod
+	}
+	return &external{name: name, args: args.Positional, flags: flags}
+}
+
+func (e *external) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	if err := CheckContextCancellation(ctx); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(e.name, e.args...)
+	if env := EnvFrom(ctx); env != nil {
+		path, err := lookPath(env, e.name)
+		if err != nil {
+			return e.startError(stderr, err)
+		}
+		cmd = exec.Command(path, e.args...)
+		cmd.Args[0] = e.name
+		cmd.Env = env.Environ()
+		cmd.Dir = env.Dir
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	group := !inForeground(ctx)
+	if group {
+		setProcessGroup(cmd)
+	}
+
+	// Feed stdin ourselves so that Wait does not hang on a reader that
+	// never produces anything once the process has exited
+	var stdinPipe io.WriteCloser
+	if file, ok := stdin.(*os.File); ok {
+		cmd.Stdin = file
+	} else if stdin != nil {
+		var err error
+		if stdinPipe, err = cmd.StdinPipe(); err != nil {
+			return err
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return e.startError(stderr, err)
+	}
+
+	stopFeed, fed := make(chan struct{}), make(chan struct{})
+	if stdinPipe != nil {
+		go func() {
+			defer close(fed)
+			feedStdin(stopFeed, stdinPipe, sharedStdin(ctx, stdin))
+		}()
+	} else {
+		close(fed)
+	}
+
+	// Escalate from SIGTERM to SIGKILL if the context ends first
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-exited:
+			return
+		case <-ctx.Done():
+		}
+		terminate(cmd, group)
+		select {
+		case <-exited:
+		case <-time.After(e.flags.GracePeriod):
+			kill(cmd, group)
+		}
+	}()
+
+	err := cmd.Wait()
+	close(exited)
+
+	// Nothing more is read for a process that has exited: closing its
+	// stdin releases a blocked write, and a blocked read is left to
+	// complete for the next command
+	close(stopFeed)
+	if stdinPipe != nil {
+		_ = stdinPipe.Close()
+	}
+	<-fed
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if errors.Is(err, ErrBrokenPipe) {
+		return ErrBrokenPipe
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		status, brokenPipe := exitStatus(exitErr.ProcessState)
+		if brokenPipe {
+			return ErrBrokenPipe
+		}
+		return &ExitError{Status: status, Err: exitErr}
+	}
+	return err
+}
+
+// foregroundKey marks the context of a shell's foreground job
+type foregroundKey struct{}
+
+// withForeground marks ctx as running a shell's foreground job, whose
+// external commands must stay in the shell's process group: it owns the
+// terminal, and a process outside it is stopped with SIGTTIN on reading it
+func withForeground(ctx context.Context) context.Context {
+	return context.WithValue(ctx, foregroundKey{}, true)
+}
+
+func inForeground(ctx context.Context) bool {
+	foreground, _ := ctx.Value(foregroundKey{}).(bool)
+	return foreground
+}
+
+// feedStdin copies stdin to the process until stdin ends or stop is closed.
+// Whatever the process could not be given goes back to stdin, for the next
+// command of a list.
+func feedStdin(stop <-chan struct{}, w io.WriteCloser, stdin *sharedReader) {
+	defer func() { _ = w.Close() }()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stdin.read(stop, buf)
+		if n > 0 {
+			written, werr := w.Write(buf[:n])
+			if werr != nil {
+				stdin.unread(buf[written:n])
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// errStopped ends a sharedReader read given up on
+var errStopped = errors.New("read stopped")
+
+// sharedReader is a stdin that commands read in turn. An external command
+// can give up a read still waiting for input, or hand back bytes it did not
+// use, and the next command reads them instead.
+type sharedReader struct {
+	r io.Reader
+
+	mu      sync.Mutex
+	left    []byte        // read but not yet consumed
+	err     error         // the error that ended the read producing left
+	pending chan struct{} // closed when a read given up on completes
+}
+
+func (s *sharedReader) Read(p []byte) (int, error) {
+	return s.read(nil, p)
+}
+
+// read reads into p, or fails with errStopped once stop is closed. A read
+// given up on carries on in the background, and what it returns goes to
+// the next caller.
+func (s *sharedReader) read(stop <-chan struct{}, p []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		if n := copy(p, s.left); n > 0 {
+			s.left = s.left[n:]
+			s.mu.Unlock()
+			return n, nil
+		}
+		if err := s.err; err != nil {
+			s.err = nil
+			s.mu.Unlock()
+			return 0, err
+		}
+		if s.pending == nil {
+			if stop == nil {
+				s.mu.Unlock()
+				return s.r.Read(p)
+			}
+			s.readAhead(len(p))
+		}
+		pending := s.pending
+		s.mu.Unlock()
+
+		select {
+		case <-pending:
+		case <-stop:
+			return 0, errStopped
+		}
+	}
+}
+
+// readAhead starts a read in the background, whose result waits in left.
+// s.mu is held.
+func (s *sharedReader) readAhead(size int) {
+	done := make(chan struct{})
+	s.pending = done
+	go func() {
+		buf := make([]byte, size)
+		n, err := s.r.Read(buf)
+		s.mu.Lock()
+		s.left = append(s.left, buf[:n]...)
+		s.err = err
+		s.pending = nil
+		s.mu.Unlock()
+		close(done)
+	}()
+}
+
+// unread hands back bytes for the next read
+func (s *sharedReader) unread(b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.left = append(append([]byte(nil), b...), s.left...)
+}
+
+// settle waits for a read given up on to complete, or for ctx to be done
+func (s *sharedReader) settle(ctx context.Context) {
+	s.mu.Lock()
+	pending := s.pending
+	s.mu.Unlock()
+	if pending != nil {
+		select {
+		case <-pending:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// stdinShare is the stdin of a command list. Its commands read it as it is
+// until an external command reads it through a sharedReader, and from then
+// on they read that, so what the external command left goes to them.
+type stdinShare struct {
+	stdin io.Reader
+
+	mu     sync.Mutex
+	shared *sharedReader
+}
+
+type stdinShareKey struct{}
+
+// shareStdin prepares stdin for the commands of a list, which run with the
+// returned context and read share.reader(). The list calls done when it
+// returns, which waits for any read an external command left unfinished:
+// none outlives the list, and what it read is dropped, as when a process
+// reads more of a pipe than it uses. Files need no sharing, since external
+// processes read them directly, and a nested list shares the outer one's.
+func shareStdin(ctx context.Context, stdin io.Reader) (context.Context, *stdinShare, func()) {
+	switch stdin.(type) {
+	case nil, *os.File:
+		return ctx, &stdinShare{stdin: stdin}, func() {}
+	}
+	if outer, _ := ctx.Value(stdinShareKey{}).(*stdinShare); outer != nil && outer.holds(stdin) {
+		return ctx, outer, func() {}
+	}
+
+	share := &stdinShare{stdin: stdin}
+	ctx = context.WithValue(ctx, stdinShareKey{}, share)
+	return ctx, share, func() {
+		share.mu.Lock()
+		shared := share.shared
+		share.mu.Unlock()
+		if shared != nil {
+			shared.settle(ctx)
+		}
+	}
+}
+
+// reader returns the stdin the next command of the list reads
+func (s *stdinShare) reader() io.Reader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shared != nil {
+		return s.shared
+	}
+	return s.stdin
+}
+
+// holds reports whether stdin is the list's stdin, as it is or shared
+func (s *stdinShare) holds(stdin io.Reader) bool {
+	if shared, ok := stdin.(*sharedReader); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return shared == s.shared
+	}
+	// Readers of uncomparable types would panic under ==
+	return reflect.ValueOf(stdin).Comparable() && stdin == s.stdin
+}
+
+// sharedStdin returns the sharedReader an external command feeds from:
+// its list's, shared from now on, or outside a list one of its own
+func sharedStdin(ctx context.Context, stdin io.Reader) *sharedReader {
+	if shared, ok := stdin.(*sharedReader); ok {
+		return shared
+	}
+	share, _ := ctx.Value(stdinShareKey{}).(*stdinShare)
+	if share == nil || !share.holds(stdin) {
+		return &sharedReader{r: stdin}
+	}
+	share.mu.Lock()
+	defer share.mu.Unlock()
+	if share.shared == nil {
+		share.shared = &sharedReader{r: stdin}
+	}
+	return share.shared
+}
+
+// lookPath finds an executable in the PATH of env, as exec.LookPath does
+// with the process's
+func lookPath(env *Env, name string) (string, error) {
+	pathVar, ok := env.Vars["PATH"]
+	if !ok || strings.ContainsAny(name, `/\`) || runtime.GOOS == "windows" {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(pathVar) {
+		if dir == "" {
+			continue
+		}
+		candidate := env.Path(filepath.Join(dir, name))
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// startError reports a failure to launch the process the way a shell does
+func (e *external) startError(stderr io.Writer, err error) error {
+	switch {
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		ErrorF(stderr, e.name, "", errors.New("command not found"))
+		return ExitWithError(StatusNotFound, err)
+	case errors.Is(err, fs.ErrPermission):
+		ErrorF(stderr, e.name, "", errors.New("permission denied"))
+		return ExitWithError(StatusCannotExecute, err)
+	}
+	ErrorF(stderr, e.name, "", err)
+	return ExitWithError(StatusCannotExecute, err)
+}
+
+// Describe renders the executable and its arguments
+func (e *external) Describe() string {
+	words := []string{QuoteWord(e.name)}
+	for _, arg := range e.args {
+		words = append(words, QuoteWord(arg))
+	}
+	return strings.Join(words, " ")
+}
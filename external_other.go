@@ -0,0 +1,26 @@
+//go:build !unix
+
+package yup
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op without Unix process groups
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminate stops the process; there is no gentler signal to send here
+func terminate(cmd *exec.Cmd, group bool) {
+	_ = cmd.Process.Kill()
+}
+
+// kill forcibly stops the process
+func kill(cmd *exec.Cmd, group bool) {
+	_ = cmd.Process.Kill()
+}
+
+// exitStatus converts a finished process's state into an exit status
+func exitStatus(state *os.ProcessState) (int, bool) {
+	return state.ExitCode(), false
+}
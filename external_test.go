@@ -0,0 +1,232 @@
+//go:build unix
+
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	yup "github.com/yupsh/framework"
+)
+
+func TestExternal(t *testing.T) {
+	t.Run("mixed with native commands", func(t *testing.T) {
+		var output strings.Builder
+		err := yup.Pipe(passthrough, yup.External("tr", "a-z", "A-Z"), passthrough).
+			Execute(context.Background(), strings.NewReader("hello\n"), &output, io.Discard)
+		if err != nil || output.String() != "HELLO\n" {
+			t.Errorf("Got %q, err %v", output.String(), err)
+		}
+	})
+
+	t.Run("traced without stdin", func(t *testing.T) {
+		var trace strings.Builder
+		err := yup.Pipe(yup.External("true")).
+			WithFlags(yup.Verbose, yup.TraceWriter{Writer: &trace}).
+			Execute(context.Background(), nil, io.Discard, io.Discard)
+		if err != nil || !strings.HasSuffix(trace.String(), "read 0 bytes (0 lines), wrote 0 bytes (0 lines), ok\n") {
+			t.Errorf("Got %v, trace %q", err, trace.String())
+		}
+	})
+
+	t.Run("exit status", func(t *testing.T) {
+		err := yup.External("sh", "-c", "exit 3").Execute(context.Background(), nil, io.Discard, io.Discard)
+		if got := yup.ExitStatus(err); got != 3 {
+			t.Errorf("Expected status 3, got %d (%v)", got, err)
+		}
+	})
+
+	t.Run("command not found", func(t *testing.T) {
+		var stderr strings.Builder
+		err := yup.External("yup-no-such-command").Execute(context.Background(), nil, io.Discard, &stderr)
+		if yup.ExitStatus(err) != yup.StatusNotFound || stderr.String() != "yup-no-such-command: command not found\n" {
+			t.Errorf("Got stderr %q, err %v", stderr.String(), err)
+		}
+	})
+
+	t.Run("cancellation escalates to SIGKILL", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		// The shell ignores SIGTERM, and so does its child
+		err := yup.External("sh", "-c", "trap '' TERM; sleep 10 & wait", yup.GracePeriod(100*time.Millisecond)).
+			Execute(ctx, nil, io.Discard, io.Discard)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Process group outlived its grace period by %v", elapsed)
+		}
+	})
+
+	t.Run("broken pipe is a clean exit", func(t *testing.T) {
+		var output strings.Builder
+		err := yup.Pipe(yup.External("yes"), head(2)).WithFlags(yup.PipeFail).
+			Execute(context.Background(), nil, &output, io.Discard)
+		if err != nil || output.String() != "y\ny\n" {
+			t.Errorf("Got %q, err %v", output.String(), err)
+		}
+	})
+}
+
+func TestExternalStdin(t *testing.T) {
+	// true never reads stdin, so whatever arrives after it exits is the
+	// next command's
+	stdin, input := io.Pipe()
+	exited := make(chan struct{})
+	signal := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		close(exited)
+		return nil
+	})
+
+	var output strings.Builder
+	done := make(chan error, 1)
+	go func() {
+		done <- yup.Seq(yup.External("true"), signal, passthrough).
+			Execute(context.Background(), stdin, &output, io.Discard)
+	}()
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("External command waited for stdin after exiting")
+	}
+	_, _ = io.WriteString(input, "for the next command\n")
+	_ = input.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output.String() != "for the next command\n" {
+		t.Errorf("Expected the input to reach the next command, got %q", output.String())
+	}
+}
+
+func TestExternalStdinList(t *testing.T) {
+	t.Run("no input lost between externals", func(t *testing.T) {
+		stdin, input := io.Pipe()
+		exited := make(chan struct{})
+		signal := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			close(exited)
+			return nil
+		})
+
+		var output strings.Builder
+		done := make(chan error, 1)
+		go func() {
+			done <- yup.Seq(yup.External("true"), signal, yup.External("cat")).
+				Execute(context.Background(), stdin, &output, io.Discard)
+		}()
+
+		<-exited
+		_, _ = io.WriteString(input, "for cat\n")
+		_ = input.Close()
+		if err := <-done; err != nil || output.String() != "for cat\n" {
+			t.Errorf("Got %q, err %v", output.String(), err)
+		}
+	})
+
+	t.Run("nested lists share stdin", func(t *testing.T) {
+		stdin, input := io.Pipe()
+		exited := make(chan struct{})
+		signal := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			close(exited)
+			return nil
+		})
+
+		var output strings.Builder
+		done := make(chan error, 1)
+		go func() {
+			done <- yup.Seq(yup.And(yup.External("true"), signal), passthrough).
+				Execute(context.Background(), stdin, &output, io.Discard)
+		}()
+
+		<-exited
+		_, _ = io.WriteString(input, "for passthrough\n")
+		_ = input.Close()
+		if err := <-done; err != nil || output.String() != "for passthrough\n" {
+			t.Errorf("Got %q, err %v", output.String(), err)
+		}
+	})
+
+	t.Run("no read outlives the list", func(t *testing.T) {
+		stdin, input := io.Pipe()
+		reader := &trackedReader{r: stdin}
+		done := make(chan error, 1)
+		go func() {
+			done <- yup.Seq(yup.External("true")).Execute(context.Background(), reader, io.Discard, io.Discard)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(100 * time.Millisecond):
+			// Still waiting for the read true left behind
+			_, _ = io.WriteString(input, "late\n")
+			<-done
+		}
+		if reader.reading.Load() {
+			t.Error("The list returned with a read of stdin pending")
+		}
+		_ = input.Close()
+	})
+}
+
+// trackedReader reports whether a read is in progress
+type trackedReader struct {
+	r       io.Reader
+	reading atomic.Bool
+}
+
+func (t *trackedReader) Read(p []byte) (int, error) {
+	t.reading.Store(true)
+	defer t.reading.Store(false)
+	return t.r.Read(p)
+}
+
+func TestExternalProcessGroup(t *testing.T) {
+	// kill -0 on the negated pid succeeds only for a process group leader
+	group := func(...any) yup.Command {
+		return yup.External("sh", "-c", `kill -0 -$$ 2>/dev/null && echo own || echo shared`)
+	}
+
+	var output strings.Builder
+	if err := group().Execute(context.Background(), nil, &output, io.Discard); err != nil || output.String() != "own\n" {
+		t.Errorf("Outside a shell: got %q, err %v", output.String(), err)
+	}
+
+	registry := yup.NewRegistry()
+	registry.Register(yup.Spec{Name: "group", New: group})
+	sh := yup.NewShell(registry)
+	var stdout syncBuilder
+	sh.Stdin, sh.Stdout, sh.Stderr = strings.NewReader(""), &stdout, io.Discard
+	if status := sh.Exec(context.Background(), "group"); status != 0 || stdout.String() != "shared\n" {
+		t.Errorf("In the foreground: got %q, status %d", stdout.String(), status)
+	}
+}
+
+func TestExternalEnv(t *testing.T) {
+	dir := t.TempDir()
+	env := &yup.Env{Vars: map[string]string{"PATH": os.Getenv("PATH"), "X": "set"}, Dir: dir}
+	ctx := yup.WithEnv(context.Background(), env)
+
+	var output strings.Builder
+	err := yup.External("sh", "-c", `echo "$X"; pwd -P`).Execute(ctx, nil, &output, io.Discard)
+	want, _ := filepath.EvalSymlinks(dir)
+	if err != nil || output.String() != "set\n"+want+"\n" {
+		t.Errorf("Got %q, err %v", output.String(), err)
+	}
+
+	var stderr strings.Builder
+	env.Vars["PATH"] = dir
+	err = yup.External("sh", "-c", "true").Execute(ctx, nil, io.Discard, &stderr)
+	if yup.ExitStatus(err) != yup.StatusNotFound {
+		t.Errorf("Expected sh not found on PATH %s, got %v (%s)", dir, err, stderr.String())
+	}
+}
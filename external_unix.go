@@ -0,0 +1,42 @@
+//go:build unix
+
+package yup
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in a process group of its own, so that
+// signals reach any children it spawns
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate asks the command to exit, with its process group if it has one
+func terminate(cmd *exec.Cmd, group bool) {
+	_ = syscall.Kill(signalTarget(cmd, group), syscall.SIGTERM)
+}
+
+// kill forcibly stops the command, with its process group if it has one
+func kill(cmd *exec.Cmd, group bool) {
+	_ = syscall.Kill(signalTarget(cmd, group), syscall.SIGKILL)
+}
+
+// signalTarget is the pid to signal: negated, it names the process group
+func signalTarget(cmd *exec.Cmd, group bool) int {
+	if group {
+		return -cmd.Process.Pid
+	}
+	return cmd.Process.Pid
+}
+
+// exitStatus converts a finished process's state into a shell exit status,
+// 128+n for death by signal n, and reports whether that signal was SIGPIPE
+func exitStatus(state *os.ProcessState) (int, bool) {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal()), ws.Signal() == syscall.SIGPIPE
+	}
+	return state.ExitCode(), false
+}
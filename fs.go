@@ -0,0 +1,185 @@
+package yup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WritableFile is a file opened for writing through a WriteFS
+type WritableFile interface {
+	fs.File
+	io.Writer
+}
+
+// WriteFS is a filesystem that can also create and write files, as
+// redirections need. Flags and permissions are those of os.OpenFile.
+type WriteFS interface {
+	fs.FS
+	OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error)
+}
+
+// ErrReadOnly is the error for writing to a filesystem that is not a WriteFS
+var ErrReadOnly = errors.New("read-only file system")
+
+// HostFS returns the operating system's filesystem, which commands use when
+// their context has none. Unlike os.DirFS it takes host paths, absolute or
+// relative to the working directory.
+func HostFS() WriteFS {
+	return hostFS{}
+}
+
+type hostFS struct{}
+
+func (hostFS) Open(name string) (fs.File, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (hostFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (hostFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (hostFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// RootFS returns the filesystem under root. Paths cannot escape it, either
+// through ".." or through symlinks.
+func RootFS(root *os.Root) WriteFS {
+	return rootFS{root}
+}
+
+type rootFS struct {
+	root *os.Root
+}
+
+func (r rootFS) Open(name string) (fs.File, error) {
+	file, err := r.root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (r rootFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	file, err := r.root.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (r rootFS) Stat(name string) (fs.FileInfo, error) {
+	return r.root.Stat(name)
+}
+
+type fsKey struct{}
+
+// WithFS returns a context whose commands open files through fsys: an
+// fstest.MapFS, a zip.Reader, a RootFS and so on. Files given to commands
+// are then slash-separated paths from the root of fsys. Redirections that
+// write need fsys to be a WriteFS. External commands still see the host.
+func WithFS(ctx context.Context, fsys fs.FS) context.Context {
+	return context.WithValue(ctx, fsKey{}, fsys)
+}
+
+// FSFrom returns the filesystem installed with WithFS, or HostFS
+func FSFrom(ctx context.Context) fs.FS {
+	if fsys, ok := ctx.Value(fsKey{}).(fs.FS); ok {
+		return fsys
+	}
+	return hostFS{}
+}
+
+// Open opens a file for reading through ctx's filesystem, relative to the
+// working directory of its Env. Errors name the file as it was given.
+func Open(ctx context.Context, name string) (fs.File, error) {
+	fsys, resolved := fsPath(ctx, name)
+	file, err := fsys.Open(resolved)
+	if err != nil {
+		return nil, renamePathError(err, name)
+	}
+	return file, nil
+}
+
+// OpenFile opens a file for writing through ctx's filesystem, as Open does
+// for reading. It fails with ErrReadOnly if the filesystem is not a WriteFS.
+func OpenFile(ctx context.Context, name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	fsys, resolved := fsPath(ctx, name)
+	wfs, ok := fsys.(WriteFS)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrReadOnly}
+	}
+	file, err := wfs.OpenFile(resolved, flag, perm)
+	if err != nil {
+		return nil, renamePathError(err, name)
+	}
+	return file, nil
+}
+
+// Stat describes a file in ctx's filesystem, following symlinks
+func Stat(ctx context.Context, name string) (fs.FileInfo, error) {
+	fsys, resolved := fsPath(ctx, name)
+	info, err := fs.Stat(fsys, resolved)
+	if err != nil {
+		return nil, renamePathError(err, name)
+	}
+	return info, nil
+}
+
+// ReadDir lists a directory in ctx's filesystem, sorted by name
+func ReadDir(ctx context.Context, name string) ([]fs.DirEntry, error) {
+	fsys, resolved := fsPath(ctx, name)
+	entries, err := fs.ReadDir(fsys, resolved)
+	if err != nil {
+		return nil, renamePathError(err, name)
+	}
+	return entries, nil
+}
+
+// fsPath returns ctx's filesystem and the path of name within it. The host
+// takes host paths resolved against the Env's working directory. Any other
+// filesystem takes paths from its root, where the Env's working directory
+// is a path too and ".." stops at the root.
+func fsPath(ctx context.Context, name string) (fs.FS, string) {
+	fsys := FSFrom(ctx)
+	if _, ok := fsys.(hostFS); ok {
+		return fsys, ResolvePath(ctx, name)
+	}
+
+	p := filepath.ToSlash(name)
+	if env := EnvFrom(ctx); env != nil && !path.IsAbs(p) {
+		p = path.Join(filepath.ToSlash(env.Dir), p)
+	}
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		p = "."
+	}
+	return fsys, p
+}
+
+// renamePathError names the file in err as it was given, not as resolved
+func renamePathError(err error, name string) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		pathErr.Path = name
+	}
+	return err
+}
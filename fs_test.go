@@ -0,0 +1,132 @@
+package yup_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	yup "github.com/yupsh/framework"
+)
+
+// copyAll is a processor that copies each source to the output
+func copyAll(ctx context.Context, source yup.InputSource, output io.Writer) error {
+	_, err := io.Copy(output, source.Reader)
+	return err
+}
+
+func TestWithFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":      {Data: []byte("a\n")},
+		"logs/b.txt": {Data: []byte("b\n")},
+	}
+
+	tests := []struct {
+		name       string
+		env        *yup.Env
+		args       []string
+		wantOutput string
+		wantStderr string
+	}{
+		{"from the root", nil, []string{"a.txt", "/logs/b.txt"}, "a\nb\n", ""},
+		{"working directory", &yup.Env{Dir: "/logs"}, []string{"b.txt", "../a.txt"}, "b\na\n", ""},
+		{"dot-dot stops at the root", &yup.Env{Dir: "/logs"}, []string{"../../../a.txt"}, "a\n", ""},
+		{"missing file", nil, []string{"nosuch", "a.txt"}, "a\n", "cat: nosuch: open nosuch: file does not exist\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := yup.WithFS(context.Background(), fsys)
+			if tt.env != nil {
+				ctx = yup.WithEnv(ctx, tt.env)
+			}
+			var output, stderr strings.Builder
+			options := yup.FileProcessorOptions{CommandName: "cat", ContinueOnError: true}
+			_ = yup.ProcessFilesWithContext(ctx, tt.args, nil, &output, &stderr, options, copyAll)
+			if output.String() != tt.wantOutput || stderr.String() != tt.wantStderr {
+				t.Errorf("Got %q, stderr %q, want %q, %q", output.String(), stderr.String(), tt.wantOutput, tt.wantStderr)
+			}
+		})
+	}
+
+	t.Run("read-only redirection", func(t *testing.T) {
+		ctx := yup.WithFS(context.Background(), fsys)
+		var stderr strings.Builder
+		err := yup.Redirect(chatty, yup.StdinFrom("a.txt"), yup.StdoutTo("out.txt")).Execute(ctx, nil, io.Discard, &stderr)
+		if yup.ExitStatus(err) != yup.StatusFailure || !strings.HasSuffix(stderr.String(), ": out.txt: read-only file system\n") {
+			t.Errorf("Got stderr %q, err %v", stderr.String(), err)
+		}
+	})
+
+	t.Run("zip archive", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		f, _ := w.Create("docs/readme.txt")
+		_, _ = io.WriteString(f, "zipped\n")
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := yup.WithFS(context.Background(), archive)
+		sources, err := yup.CollectInputSourcesWithContext(ctx, []string{"docs/readme.txt"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer yup.CloseInputSources(sources)
+		if data, _ := io.ReadAll(sources[0].Reader); string(data) != "zipped\n" {
+			t.Errorf("Got %q", data)
+		}
+		if _, ok := sources[0].OSFile(); ok {
+			t.Error("Expected no host file inside an archive")
+		}
+	})
+
+	t.Run("host file", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "a.txt")
+		if err := os.WriteFile(name, []byte("a\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sources, err := yup.CollectInputSourcesWithContext(context.Background(), []string{name}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer yup.CloseInputSources(sources)
+		if file, ok := sources[0].OSFile(); !ok || file.Name() != name {
+			t.Errorf("Got host file %v, %v", file, ok)
+		}
+	})
+}
+
+func TestRootFS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("data\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	ctx := yup.WithFS(context.Background(), yup.RootFS(root))
+
+	err = yup.Redirect(chatty, yup.StdinFrom("in.txt"), yup.StdoutTo("/out.txt")).Execute(ctx, nil, io.Discard, io.Discard)
+	if data, _ := os.ReadFile(filepath.Join(dir, "out.txt")); err != nil || string(data) != "data\n" {
+		t.Errorf("Got %q, err %v", data, err)
+	}
+
+	// A symlink cannot lead out of the root
+	if err := os.Symlink(filepath.Dir(dir), filepath.Join(dir, "up")); err != nil {
+		t.Skip("needs symlinks:", err)
+	}
+	if _, err := yup.Open(ctx, "up/"+filepath.Base(dir)+"/in.txt"); err == nil {
+		t.Error("Open() followed a symlink out of the root")
+	}
+}
@@ -0,0 +1,407 @@
+package yup
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// NoMatch says what Expand does with a pattern that matches no files
+type NoMatch int
+
+const (
+	NoMatchLiteral NoMatch = iota // Keep the pattern as a word, as POSIX sh does
+	NoMatchNull                   // Drop the pattern, as bash's nullglob does
+	NoMatchFail                   // Fail with a NoMatchError, as bash's failglob does
+)
+
+// GlobOptions controls how Expand matches patterns
+type GlobOptions struct {
+	Dotfiles bool    // Let wildcards match names starting with "." (dotglob)
+	NoMatch  NoMatch // What to do with patterns that match nothing
+}
+
+// NoMatchError is the error for a pattern that matched no files under
+// NoMatchFail
+type NoMatchError struct {
+	Pattern string
+}
+
+func (e *NoMatchError) Error() string {
+	return "no match: " + e.Pattern
+}
+
+// Expand expands braces and wildcards in words against ctx's filesystem,
+// relative to the working directory of its Env. Braces expand first, so
+// "{a,b}*.go" is "a*.go b*.go". The wildcards are *, ? and bracket
+// expressions like [a-z], [!0-9] and [[:alpha:]], and a backslash quotes
+// the next character. A "[" that starts no valid bracket expression
+// matches itself, as in the shell. A "**" path segment matches any number
+// of directories, without following symlinks. Each pattern's matches are
+// sorted; words without wildcards are kept whether or not they name a
+// file. Words kept as they are, including patterns kept under
+// NoMatchLiteral, lose their quoting backslashes like matched patterns do.
+func Expand(ctx context.Context, words []string, options GlobOptions) ([]string, error) {
+	var expanded []string
+	for _, word := range words {
+		for _, pattern := range ExpandBraces(word) {
+			if !hasGlobMeta(pattern) {
+				expanded = append(expanded, unescapeGlob(pattern))
+				continue
+			}
+			if matches := Glob(ctx, pattern, options); len(matches) > 0 {
+				expanded = append(expanded, matches...)
+				continue
+			}
+			switch options.NoMatch {
+			case NoMatchNull:
+			case NoMatchFail:
+				return nil, &NoMatchError{Pattern: pattern}
+			default:
+				expanded = append(expanded, unescapeGlob(pattern))
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// Glob returns the sorted names of the files in ctx's filesystem that
+// match pattern, which is matched as Expand matches it but without brace
+// expansion. A pattern ending in "/" matches only directories.
+func Glob(ctx context.Context, pattern string, options GlobOptions) []string {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	segments := strings.Split(strings.TrimRight(pattern, "/"), "/")
+
+	candidates := []string{""}
+	if strings.HasPrefix(pattern, "/") {
+		candidates, segments = []string{"/"}, segments[1:]
+	}
+
+	// A trailing literal segment is only known to exist once checked
+	checkExists := true
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		var next []string
+		switch {
+		case segment == "**":
+			// Last, it matches files as well
+			for _, dir := range candidates {
+				next = append(next, dir)
+				next = globTree(ctx, dir, last && !dirOnly, options, next)
+			}
+			checkExists = false
+		case !hasGlobMeta(segment):
+			for _, dir := range candidates {
+				next = append(next, joinGlob(dir, unescapeGlob(segment)))
+			}
+			checkExists = true
+		default:
+			for _, dir := range candidates {
+				entries, err := ReadDir(ctx, globDir(dir))
+				if err != nil {
+					continue
+				}
+				for _, entry := range entries {
+					if matchGlob(segment, entry.Name(), options.Dotfiles) && (last && !dirOnly || isDir(ctx, globDir(dir), entry)) {
+						next = append(next, joinGlob(dir, entry.Name()))
+					}
+				}
+			}
+			checkExists = false
+		}
+		candidates = next
+	}
+
+	var matches []string
+	for _, name := range candidates {
+		if name == "" {
+			continue
+		}
+		if checkExists || dirOnly {
+			info, err := Stat(ctx, name)
+			if err != nil || dirOnly && !info.IsDir() {
+				continue
+			}
+		}
+		if dirOnly && name != "/" {
+			name += "/"
+		}
+		matches = append(matches, name)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// globTree appends every directory below dir, and with files set every
+// file, depth first, for "**"
+func globTree(ctx context.Context, dir string, files bool, options GlobOptions, names []string) []string {
+	entries, err := ReadDir(ctx, globDir(dir))
+	if err != nil {
+		return names
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") && !options.Dotfiles || !entry.IsDir() && !files {
+			continue
+		}
+		name := joinGlob(dir, entry.Name())
+		names = append(names, name)
+		if entry.IsDir() {
+			names = globTree(ctx, name, files, options, names)
+		}
+	}
+	return names
+}
+
+// globDir names the directory a candidate stands for, "" being the
+// working directory
+func globDir(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
+
+func joinGlob(dir, name string) string {
+	switch {
+	case dir == "":
+		return name
+	case strings.HasSuffix(dir, "/"):
+		return dir + name
+	}
+	return dir + "/" + name
+}
+
+// hasGlobMeta reports whether s has an unquoted wildcard
+func hasGlobMeta(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeGlob removes the backslashes quoting characters in a pattern
+func unescapeGlob(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// ExpandBraces expands the brace alternatives in word, left to right, so
+// "a{b,c{d,e}}f" is "abf acdf acef". Braces without a comma, and those
+// quoted with a backslash, are kept as they are.
+func ExpandBraces(word string) []string {
+	open, alternatives, end := findBraces(word)
+	if open < 0 {
+		return []string{word}
+	}
+	prefix, suffix := word[:open], word[end+1:]
+	var words []string
+	for _, alternative := range alternatives {
+		words = append(words, ExpandBraces(prefix+alternative+suffix)...)
+	}
+	return words
+}
+
+// findBraces finds the first brace pair holding a top-level comma and
+// returns its offsets and the alternatives between them
+func findBraces(word string) (int, []string, int) {
+	for open := 0; open < len(word); open++ {
+		switch word[open] {
+		case '\\':
+			open++
+			continue
+		case '{':
+		default:
+			continue
+		}
+
+		depth, start := 0, open+1
+		var alternatives []string
+		for i := open + 1; i < len(word); i++ {
+			switch word[i] {
+			case '\\':
+				i++
+			case '{':
+				depth++
+			case ',':
+				if depth == 0 {
+					alternatives = append(alternatives, word[start:i])
+					start = i + 1
+				}
+			case '}':
+				if depth > 0 {
+					depth--
+					continue
+				}
+				if alternatives != nil {
+					return open, append(alternatives, word[start:i]), i
+				}
+				i = len(word) // no comma: try the next brace
+			}
+		}
+	}
+	return -1, nil, -1
+}
+
+// matchGlob reports whether name matches one path segment of a pattern. A
+// leading "." in name must be matched literally unless dotfiles is set.
+func matchGlob(pattern, name string, dotfiles bool) bool {
+	if strings.HasPrefix(name, ".") && !dotfiles && !strings.HasPrefix(pattern, ".") {
+		return false
+	}
+	return matchFrom(pattern, name)
+}
+
+func matchFrom(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchFrom(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(name)
+			pattern, name = pattern[1:], name[size:]
+		case '[':
+			if name == "" {
+				return false
+			}
+			r, size := utf8.DecodeRuneInString(name)
+			matched, rest, ok := matchBracket(pattern, r)
+			if !ok {
+				// Not a bracket expression: the [ matches itself
+				if name[0] != '[' {
+					return false
+				}
+				pattern, name = pattern[1:], name[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			pattern, name = rest, name[size:]
+		default:
+			c := pattern[0]
+			if c == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+				c = pattern[0]
+			}
+			if name == "" || name[0] != c {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+	return name == ""
+}
+
+// matchBracket matches r against the bracket expression starting pattern
+// and returns the pattern after it. It reports false if the expression is
+// malformed, as an unclosed one is.
+func matchBracket(pattern string, r rune) (bool, string, bool) {
+	i := 1
+	negate := i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^')
+	if negate {
+		i++
+	}
+
+	matched := false
+	for first := true; ; first = false {
+		if i >= len(pattern) {
+			return false, "", false
+		}
+		if pattern[i] == ']' && !first {
+			break
+		}
+
+		// A character class such as [:alpha:]
+		if strings.HasPrefix(pattern[i:], "[:") {
+			end := strings.Index(pattern[i+2:], ":]")
+			if end < 0 {
+				return false, "", false
+			}
+			class, ok := bracketClasses[pattern[i+2:i+2+end]]
+			if !ok {
+				return false, "", false
+			}
+			matched = matched || class(r)
+			i += end + 4
+			continue
+		}
+
+		lo, size := bracketChar(pattern[i:])
+		i += size
+		hi := lo
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			hi, size = bracketChar(pattern[i+1:])
+			i += 1 + size
+		}
+		matched = matched || lo <= r && r <= hi
+	}
+	return matched != negate, pattern[i+1:], true
+}
+
+// bracketChar decodes one possibly escaped character of a bracket
+// expression
+func bracketChar(s string) (rune, int) {
+	if s[0] == '\\' && len(s) > 1 {
+		r, size := utf8.DecodeRuneInString(s[1:])
+		return r, size + 1
+	}
+	return utf8.DecodeRuneInString(s)
+}
+
+// bracketClasses are the POSIX character classes, limited to ASCII
+var bracketClasses = map[string]func(rune) bool{
+	"alnum":  func(r rune) bool { return isAlpha(r) || isDigit(r) },
+	"alpha":  isAlpha,
+	"blank":  func(r rune) bool { return r == ' ' || r == '\t' },
+	"cntrl":  func(r rune) bool { return r < 0x20 || r == 0x7f },
+	"digit":  isDigit,
+	"graph":  func(r rune) bool { return r > ' ' && r < 0x7f },
+	"lower":  func(r rune) bool { return r >= 'a' && r <= 'z' },
+	"print":  func(r rune) bool { return r >= ' ' && r < 0x7f },
+	"punct":  func(r rune) bool { return r > ' ' && r < 0x7f && !isAlpha(r) && !isDigit(r) },
+	"space":  func(r rune) bool { return r == ' ' || r >= '\t' && r <= '\r' },
+	"upper":  func(r rune) bool { return r >= 'A' && r <= 'Z' },
+	"xdigit": func(r rune) bool { return isDigit(r) || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' },
+}
+
+func isAlpha(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' }
+func isDigit(r rune) bool { return r >= '0' && r <= '9' }
+
+// expandArgs applies FileProcessorOptions.Glob to a command's file
+// arguments, reporting a failed expansion as a file error is reported
+func expandArgs(ctx context.Context, args []string, stderr io.Writer, options FileProcessorOptions) ([]string, error) {
+	expanded, err := Expand(ctx, args, options.GlobOptions)
+	if err != nil {
+		ErrorF(stderr, options.CommandName, "", err)
+		return nil, err
+	}
+	return expanded, nil
+}
@@ -0,0 +1,132 @@
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	yup "github.com/yupsh/framework"
+)
+
+var globFS = fstest.MapFS{
+	"a.go":           {Data: []byte("a\n")},
+	"b.go":           {Data: []byte("b\n")},
+	"c.txt":          {Data: []byte("c\n")},
+	"a[1.txt":        {},
+	".hidden.go":     {},
+	"file1":          {},
+	"fileA":          {},
+	"docs/readme.md": {},
+	"src/x.go":       {},
+	"src/lib/y.go":   {},
+	"src/.git/z.go":  {},
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		words   []string
+		options yup.GlobOptions
+		dir     string
+		want    []string
+	}{
+		{"star", []string{"*.go"}, yup.GlobOptions{}, "", []string{"a.go", "b.go"}},
+		{"question mark", []string{"?.txt"}, yup.GlobOptions{}, "", []string{"c.txt"}},
+		{"bracket", []string{"[ab].go"}, yup.GlobOptions{}, "", []string{"a.go", "b.go"}},
+		{"negated bracket", []string{"[!a].go"}, yup.GlobOptions{}, "", []string{"b.go"}},
+		{"character class", []string{"file[[:digit:]]", "file[[:upper:]]"}, yup.GlobOptions{}, "", []string{"file1", "fileA"}},
+		{"braces", []string{"{c,a}.*"}, yup.GlobOptions{}, "", []string{"c.txt", "a.go"}},
+		{"globstar", []string{"**/*.go"}, yup.GlobOptions{}, "", []string{"a.go", "b.go", "src/lib/y.go", "src/x.go"}},
+		{"trailing globstar", []string{"src/**"}, yup.GlobOptions{}, "", []string{"src", "src/lib", "src/lib/y.go", "src/x.go"}},
+		{"directories only", []string{"*/"}, yup.GlobOptions{}, "", []string{"docs/", "src/"}},
+		{"wildcard directory", []string{"*/*/y.go"}, yup.GlobOptions{}, "", []string{"src/lib/y.go"}},
+		{"dotfiles", []string{"*.go"}, yup.GlobOptions{Dotfiles: true}, "", []string{".hidden.go", "a.go", "b.go"}},
+		{"explicit dot", []string{".*"}, yup.GlobOptions{}, "", []string{".hidden.go"}},
+		{"no match is literal", []string{"*.none", "a.go"}, yup.GlobOptions{}, "", []string{"*.none", "a.go"}},
+		{"nullglob", []string{"*.none", "a.go"}, yup.GlobOptions{NoMatch: yup.NoMatchNull}, "", []string{"a.go"}},
+		{"words kept", []string{"missing", "-", `\*.go`}, yup.GlobOptions{}, "", []string{"missing", "-", "*.go"}},
+		{"escaped wildcards", []string{`a\*b`, `\[ab].go`, `*.no\ne`}, yup.GlobOptions{}, "", []string{"a*b", "[ab].go", "*.none"}},
+		{"escaped braces", []string{`{x,y}\{z`, `\{c,a}.go`}, yup.GlobOptions{}, "", []string{"x{z", "y{z", "{c,a}.go"}},
+		{"escaped characters match", []string{`\a.g?`}, yup.GlobOptions{}, "", []string{"a.go"}},
+		{"working directory", []string{"*.go", "../c.*"}, yup.GlobOptions{}, "/src", []string{"x.go", "../c.txt"}},
+		{"absolute", []string{"/src/*.go"}, yup.GlobOptions{}, "/docs", []string{"/src/x.go"}},
+		{"unclosed bracket", []string{"a[1.txt", "a[*", "b[1"}, yup.GlobOptions{}, "", []string{"a[1.txt", "a[1.txt", "b[1"}},
+		{"unknown class", []string{"[[:nosuch:]]*"}, yup.GlobOptions{}, "", []string{"[[:nosuch:]]*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := yup.WithFS(context.Background(), globFS)
+			if tt.dir != "" {
+				ctx = yup.WithEnv(ctx, &yup.Env{Dir: tt.dir})
+			}
+			got, err := yup.Expand(ctx, tt.words, tt.options)
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("Expand(%q) = %q, %v, want %q", tt.words, got, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("failglob", func(t *testing.T) {
+		ctx := yup.WithFS(context.Background(), globFS)
+		_, err := yup.Expand(ctx, []string{"a.go", "*.none"}, yup.GlobOptions{NoMatch: yup.NoMatchFail})
+		var noMatch *yup.NoMatchError
+		if !errors.As(err, &noMatch) || err.Error() != "no match: *.none" {
+			t.Errorf("Expected a NoMatchError, got %v", err)
+		}
+	})
+}
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"a{b,c{d,e}}f", []string{"abf", "acdf", "acef"}},
+		{"{x,y}{1,2}", []string{"x1", "x2", "y1", "y2"}},
+		{"file{,.bak}", []string{"file", "file.bak"}},
+		{"{}", []string{"{}"}},
+		{"{a}", []string{"{a}"}},
+		{"{a{b,c}}", []string{"{ab}", "{ac}"}},
+		{`\{a,b}`, []string{`\{a,b}`}},
+		{"{a,b", []string{"{a,b"}},
+	}
+	for _, tt := range tests {
+		if got := yup.ExpandBraces(tt.word); !slices.Equal(got, tt.want) {
+			t.Errorf("ExpandBraces(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestProcessFilesGlob(t *testing.T) {
+	ctx := yup.WithFS(context.Background(), globFS)
+	tests := []struct {
+		name       string
+		args       []string
+		options    yup.GlobOptions
+		wantOutput string
+		wantStderr string
+	}{
+		{"expanded", []string{"*.go", "*.txt"}, yup.GlobOptions{}, "a\nb\nc\n", ""},
+		{"no match", []string{"*.none"}, yup.GlobOptions{}, "", "cat: *.none: open *.none: file does not exist\n"},
+		{"nullglob reads nothing", []string{"*.none"}, yup.GlobOptions{NoMatch: yup.NoMatchNull}, "", ""},
+		{"failglob", []string{"*.go", "*.none"}, yup.GlobOptions{NoMatch: yup.NoMatchFail}, "", "cat: no match: *.none\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output, stderr strings.Builder
+			options := yup.FileProcessorOptions{CommandName: "cat", Glob: true, GlobOptions: tt.options}
+			_ = yup.ProcessFilesWithContext(ctx, tt.args, strings.NewReader("stdin\n"), &output, &stderr, options,
+				func(ctx context.Context, source yup.InputSource, output io.Writer) error {
+					_, err := io.Copy(output, source.Reader)
+					return err
+				})
+			if output.String() != tt.wantOutput || stderr.String() != tt.wantStderr {
+				t.Errorf("Got %q, stderr %q, want %q, %q", output.String(), stderr.String(), tt.wantOutput, tt.wantStderr)
+			}
+		})
+	}
+}
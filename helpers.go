@@ -3,8 +3,10 @@ package yup
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"strings"
 )
@@ -13,17 +15,51 @@ import (
 type InputSource struct {
 	Reader   io.Reader
 	Filename string
-	File     *os.File // nil for stdin
+	File     fs.File // nil for stdin
+
+	closer func() error // releases non-file sources such as substitutions
 }
 
 // Close closes the underlying file if it exists
 func (is InputSource) Close() error {
+	if is.closer != nil {
+		return is.closer()
+	}
 	if is.File != nil {
 		return is.File.Close()
 	}
 	return nil
 }
 
+// OSFile returns the host file behind the source, for callers that need an
+// *os.File, as File was before it became an fs.File. It reports false for
+// stdin, substitutions and files on other filesystems.
+func (is InputSource) OSFile() (*os.File, bool) {
+	file, ok := is.File.(*os.File)
+	return file, ok
+}
+
+// openInput opens one positional argument: "-" is stdin, a process
+// substitution starts its command, and anything else is opened as a file
+// through ctx's filesystem, relative to the working directory of its Env
+func openInput(ctx context.Context, filename string, stdin io.Reader) (InputSource, error) {
+	if filename == "-" {
+		return InputSource{Reader: stdin, Filename: "stdin"}, nil
+	}
+	if source, ok, err := openSubstitution(ctx, filename); ok {
+		return source, err
+	}
+	file, err := Open(ctx, filename)
+	if err != nil {
+		return InputSource{}, err
+	}
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		_ = file.Close()
+		return InputSource{}, ErrIsDirectory
+	}
+	return InputSource{Reader: file, Filename: filename, File: file}, nil
+}
+
 // ProcessorFunc is a function that processes a single input source
 type ProcessorFunc func(source InputSource, output io.Writer) error
 
@@ -34,6 +70,18 @@ type FileProcessorOptions struct {
 	HeaderFormat    string // Format string for headers (default: "==> %s <==\n")
 	BlankBetween    bool   // Add blank line between files
 	ContinueOnError bool   // Continue processing other files on error
+
+	// Glob expands wildcards and braces in the file arguments with Expand.
+	// Arguments that expand to nothing are no files, not stdin.
+	Glob        bool
+	GlobOptions GlobOptions // Dotfile and no-match policy for Glob
+
+	// Recursive processes the files below directory arguments, in name
+	// order; otherwise a directory is reported with ErrIsDirectory
+	Recursive bool
+	Walk      WalkOptions // Which files Recursive visits
+
+	Decompress bool // Decompress gzip, zlib and bzip2 input, stdin included
 }
 
 // ProcessFiles handles the common pattern of processing stdin or multiple files
@@ -44,100 +92,41 @@ func ProcessFiles(
 	options FileProcessorOptions,
 	processor ProcessorFunc,
 ) error {
-	// Set defaults
-	if options.HeaderFormat == "" {
-		options.HeaderFormat = "==> %s <==\n"
-	}
-
-	// If no files specified, read from stdin
-	if len(positionalArgs) == 0 {
-		source := InputSource{Reader: stdin, Filename: "stdin"}
-		return processor(source, output)
-	}
-
-	multipleFiles := len(positionalArgs) > 1 && options.ShowHeaders
-	var lastError error
-
-	// Process each file
-	for i, filename := range positionalArgs {
-		var source InputSource
-
-		if filename == "-" {
-			source = InputSource{Reader: stdin, Filename: "stdin"}
-		} else {
-			file, err := os.Open(filename)
-			if err != nil {
-				ErrorF(stderr, options.CommandName, filename, err)
-				if options.ContinueOnError {
-					lastError = err
-					continue
-				}
-				return err
-			}
-			source = InputSource{Reader: file, Filename: filename, File: file}
-		}
-
-		// Show header if needed
-		if multipleFiles {
-			if i > 0 && options.BlankBetween {
-				_, _ = fmt.Fprintln(output)
-			}
-			_, _ = fmt.Fprintf(output, options.HeaderFormat, source.Filename)
-		}
-
-		// Process the source
-		err := processor(source, output)
-
-		// Close file if it was opened
-		if closeErr := source.Close(); closeErr != nil && err == nil {
-			err = closeErr
-		}
-
-		if err != nil {
-			ErrorF(stderr, options.CommandName, source.Filename, err)
-			if options.ContinueOnError {
-				lastError = err
-				continue
-			}
-			return err
-		}
-	}
-
-	return lastError
+	return ProcessFilesWithContext(context.Background(), positionalArgs, stdin, output, stderr, options,
+		func(ctx context.Context, source InputSource, output io.Writer) error {
+			return processor(source, output)
+		})
 }
 
 // LineProcessor is a function that processes individual lines
 type LineProcessor func(lineNum int, line string, output io.Writer) error
 
-// ProcessLines reads lines from a reader and processes each one
+// ProcessLines reads lines of any length from a reader and processes each one
 func ProcessLines(reader io.Reader, output io.Writer, processor LineProcessor) error {
-	scanner := bufio.NewScanner(reader)
-	lineNum := 1
-
-	for scanner.Scan() {
-		if err := processor(lineNum, scanner.Text(), output); err != nil {
-			return err
-		}
-		lineNum++
-	}
-
-	return scanner.Err()
+	return scanLines(context.Background(), reader, func(lineNum int, line string) error {
+		return processor(lineNum, line, output)
+	})
 }
 
 // ReadAllLines reads all lines from a reader into a slice
 func ReadAllLines(reader io.Reader) ([]string, error) {
 	var lines []string
-	scanner := bufio.NewScanner(reader)
-
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-
-	return lines, scanner.Err()
+	err := scanLines(context.Background(), reader, func(lineNum int, line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	return lines, err
 }
 
 // CollectInputSources collects multiple input sources (stdin + files)
 func CollectInputSources(positionalArgs []string, stdin io.Reader) ([]InputSource, error) {
+	return CollectInputSourcesWithContext(context.Background(), positionalArgs, stdin)
+}
+
+// CollectInputSourcesWithContext collects multiple input sources, opening
+// files through ctx's filesystem and relative to the working directory of
+// its Env
+func CollectInputSourcesWithContext(ctx context.Context, positionalArgs []string, stdin io.Reader) ([]InputSource, error) {
 	var sources []InputSource
 
 	if len(positionalArgs) == 0 {
@@ -146,15 +135,12 @@ func CollectInputSources(positionalArgs []string, stdin io.Reader) ([]InputSourc
 	}
 
 	for _, filename := range positionalArgs {
-		if filename == "-" {
-			sources = append(sources, InputSource{Reader: stdin, Filename: "stdin"})
-		} else {
-			file, err := os.Open(filename)
-			if err != nil {
-				return nil, fmt.Errorf("cannot open %s: %v", filename, err)
-			}
-			sources = append(sources, InputSource{Reader: file, Filename: filename, File: file})
+		source, err := openInput(ctx, filename, stdin)
+		if err != nil {
+			_ = CloseInputSources(sources)
+			return nil, fmt.Errorf("cannot open %s: %v", filename, err)
 		}
+		sources = append(sources, source)
 	}
 
 	return sources, nil
@@ -197,19 +183,17 @@ func ProcessSingleFile(
 		return processor(stdin, "stdin")
 	}
 
-	file, err := os.Open(filename)
+	source, err := openInput(context.Background(), filename, stdin)
 	if err != nil {
 		ErrorF(stderr, commandName, filename, err)
 		return err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(file)
 
-	return processor(file, filename)
+	err = processor(source.Reader, source.Filename)
+	if closeErr := source.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 // RequireArguments checks that the required number of arguments are provided
@@ -263,49 +247,71 @@ func ProcessFilesWithContext(
 		options.HeaderFormat = "==> %s <==\n"
 	}
 
+	if options.Glob && len(positionalArgs) > 0 {
+		var err error
+		if positionalArgs, err = expandArgs(ctx, positionalArgs, stderr, options); err != nil || len(positionalArgs) == 0 {
+			return err
+		}
+	}
+
 	// If no files specified, read from stdin
 	if len(positionalArgs) == 0 {
 		source := InputSource{Reader: stdin, Filename: "stdin"}
+		if options.Decompress {
+			reader, err := Decompress(stdin)
+			if err != nil {
+				ErrorF(stderr, options.CommandName, source.Filename, err)
+				return err
+			}
+			source.Reader = reader
+		}
 		return processor(ctx, source, output)
 	}
 
-	multipleFiles := len(positionalArgs) > 1 && options.ShowHeaders
+	multipleFiles := options.ShowHeaders && (len(positionalArgs) > 1 || options.Recursive)
 	var lastError error
+	count := 0
+
+	// fail reports an error, returning nil to carry on with the next file
+	fail := func(filename string, err error) error {
+		ErrorF(stderr, options.CommandName, filename, err)
+		if options.ContinueOnError {
+			lastError = err
+			return nil
+		}
+		return err
+	}
 
-	// Process each file
-	for i, filename := range positionalArgs {
+	processFile := func(filename string) error {
 		// Check for cancellation before each file
 		if err := CheckContextCancellation(ctx); err != nil {
 			return err
 		}
+		count++
 
-		var source InputSource
-
-		if filename == "-" {
-			source = InputSource{Reader: stdin, Filename: "stdin"}
-		} else {
-			file, err := os.Open(filename)
-			if err != nil {
-				ErrorF(stderr, options.CommandName, filename, err)
-				if options.ContinueOnError {
-					lastError = err
-					continue
-				}
-				return err
-			}
-			source = InputSource{Reader: file, Filename: filename, File: file}
+		source, err := openInput(ctx, filename, stdin)
+		if err != nil {
+			return fail(filename, err)
 		}
 
 		// Show header if needed
 		if multipleFiles {
-			if i > 0 && options.BlankBetween {
+			if count > 1 && options.BlankBetween {
 				_, _ = fmt.Fprintln(output)
 			}
 			_, _ = fmt.Fprintf(output, options.HeaderFormat, source.Filename)
 		}
 
-		// Process the source
-		err := processor(ctx, source, output)
+		// Process the source, decompressed if asked
+		if options.Decompress {
+			var reader io.Reader
+			if reader, err = Decompress(source.Reader); err == nil {
+				source.Reader = reader
+			}
+		}
+		if err == nil {
+			err = processor(ctx, source, output)
+		}
 
 		// Close file if it was opened
 		if closeErr := source.Close(); closeErr != nil && err == nil {
@@ -313,11 +319,20 @@ func ProcessFilesWithContext(
 		}
 
 		if err != nil {
-			ErrorF(stderr, options.CommandName, source.Filename, err)
-			if options.ContinueOnError {
-				lastError = err
-				continue
-			}
+			return fail(source.Filename, err)
+		}
+		return nil
+	}
+
+	// Process each file, or each file below a directory
+	for _, filename := range positionalArgs {
+		var err error
+		if options.Recursive {
+			err = walkFiles(ctx, filename, options.Walk, processFile, fail)
+		} else {
+			err = processFile(filename)
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -328,24 +343,16 @@ func ProcessFilesWithContext(
 // LineProcessorWithContext is a function that processes individual lines with context support
 type LineProcessorWithContext func(ctx context.Context, lineNum int, line string, output io.Writer) error
 
-// ProcessLinesWithContext reads lines from a reader and processes each one with context cancellation support
+// ProcessLinesWithContext reads lines from a reader and processes each one with context cancellation support.
+// Lines may be any length unless ctx caps them with WithMaxLineLength.
 func ProcessLinesWithContext(ctx context.Context, reader io.Reader, output io.Writer, processor LineProcessorWithContext) error {
-	scanner := bufio.NewScanner(reader)
-	lineNum := 1
-
-	for scanner.Scan() {
+	return scanLines(ctx, reader, func(lineNum int, line string) error {
 		// Check for cancellation before each line
 		if err := CheckContextCancellation(ctx); err != nil {
 			return err
 		}
-
-		if err := processor(ctx, lineNum, scanner.Text(), output); err != nil {
-			return err
-		}
-		lineNum++
-	}
-
-	return scanner.Err()
+		return processor(ctx, lineNum, line, output)
+	})
 }
 
 // ProcessSingleFileWithContext handles the common pattern of processing exactly one file or stdin with context support
@@ -371,22 +378,21 @@ func ProcessSingleFileWithContext(
 		return processor(ctx, stdin, "stdin")
 	}
 
-	file, err := os.Open(filename)
+	source, err := openInput(ctx, filename, stdin)
 	if err != nil {
 		ErrorF(stderr, commandName, filename, err)
 		return err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(file)
 
-	return processor(ctx, file, filename)
+	err = processor(ctx, source.Reader, source.Filename)
+	if closeErr := source.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
 }
 
-// ScanWithContext creates a scanner that checks for context cancellation on each scan
+// ScanWithContext creates a scanner that checks for context cancellation on each scan.
+// Create the scanner with NewScanner so that lines over 64 KiB do not fail.
 func ScanWithContext(ctx context.Context, scanner *bufio.Scanner) bool {
 	// Check for cancellation before scanning
 	if err := CheckContextCancellation(ctx); err != nil {
@@ -485,8 +491,9 @@ func (c StandardCommand[F]) RequireArgsExact(count int, stderr io.Writer) error
 
 // Error formats standardized error messages
 func (c StandardCommand[F]) Error(stderr io.Writer, message string) error {
-	ErrorF(stderr, c.Name, "", fmt.Errorf(message))
-	return fmt.Errorf(message)
+	err := errors.New(message)
+	ErrorF(stderr, c.Name, "", err)
+	return err
 }
 
 // ProcessFiles executes file processing with standard options
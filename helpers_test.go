@@ -5,10 +5,12 @@ import (
 	`bytes`
 	"context"
 	`errors`
+	"fmt"
 	"io"
 	`reflect`
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	yup "github.com/yupsh/framework"
@@ -311,6 +313,12 @@ func BenchmarkCopyWithContext(b *testing.B) {
 	}
 }
 
+// copySource is a ProcessorFunc that copies each source to the output
+func copySource(source yup.InputSource, output io.Writer) error {
+	_, err := io.Copy(output, source.Reader)
+	return err
+}
+
 func TestProcessFiles(t *testing.T) {
 	type args struct {
 		positionalArgs []string
@@ -325,7 +333,39 @@ func TestProcessFiles(t *testing.T) {
 		wantStderr string
 		wantErr    bool
 	}{
-		{},
+		{
+			name:       "stdin",
+			args:       args{stdin: strings.NewReader("input\n"), processor: copySource},
+			wantOutput: "input\n",
+		},
+		{
+			name:       "dash is stdin",
+			args:       args{positionalArgs: []string{"-"}, stdin: strings.NewReader("input\n"), processor: copySource},
+			wantOutput: "input\n",
+		},
+		{
+			name: "missing file",
+			args: args{
+				positionalArgs: []string{"yup-no-such-file", "-"},
+				stdin:          strings.NewReader("input\n"),
+				options:        yup.FileProcessorOptions{CommandName: "cat", ContinueOnError: true},
+				processor:      copySource,
+			},
+			wantOutput: "input\n",
+			wantStderr: "cat: yup-no-such-file: open yup-no-such-file: no such file or directory\n",
+			wantErr:    true,
+		},
+		{
+			name: "stop at the first error",
+			args: args{
+				positionalArgs: []string{"yup-no-such-file", "-"},
+				stdin:          strings.NewReader("input\n"),
+				options:        yup.FileProcessorOptions{CommandName: "cat"},
+				processor:      copySource,
+			},
+			wantStderr: "cat: yup-no-such-file: open yup-no-such-file: no such file or directory\n",
+			wantErr:    true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -346,7 +386,14 @@ func TestProcessFiles(t *testing.T) {
 	}
 }
 
+// numberLine is a LineProcessor that prefixes lines with their numbers
+func numberLine(lineNum int, line string, output io.Writer) error {
+	_, err := fmt.Fprintf(output, "%d %s\n", lineNum, line)
+	return err
+}
+
 func TestProcessLines(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
 	type args struct {
 		reader    io.Reader
 		processor yup.LineProcessor
@@ -357,7 +404,28 @@ func TestProcessLines(t *testing.T) {
 		wantOutput string
 		wantErr    bool
 	}{
-		{},
+		{
+			name:       "numbered",
+			args:       args{reader: strings.NewReader("a\nb\r\nc"), processor: numberLine},
+			wantOutput: "1 a\n2 b\n3 c\n",
+		},
+		{
+			name:       "empty",
+			args:       args{reader: strings.NewReader(""), processor: numberLine},
+			wantOutput: "",
+		},
+		{
+			name:       "longer than bufio.MaxScanTokenSize",
+			args:       args{reader: strings.NewReader(long + "\nb\n"), processor: numberLine},
+			wantOutput: "1 " + long + "\n2 b\n",
+		},
+		{
+			name: "processor error",
+			args: args{reader: strings.NewReader("a\nb\n"), processor: func(lineNum int, line string, output io.Writer) error {
+				return errors.New("failed")
+			}},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -384,7 +452,21 @@ func TestReadAllLines(t *testing.T) {
 		want    []string
 		wantErr bool
 	}{
-		{},
+		{
+			name: "lines",
+			args: args{reader: strings.NewReader("a\n\nb\r\nc")},
+			want: []string{"a", "", "b", "c"},
+		},
+		{
+			name: "empty",
+			args: args{reader: strings.NewReader("")},
+			want: nil,
+		},
+		{
+			name: "long line",
+			args: args{reader: strings.NewReader(strings.Repeat("x", 1<<20))},
+			want: []string{strings.Repeat("x", 1<<20)},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -401,6 +483,7 @@ func TestReadAllLines(t *testing.T) {
 }
 
 func TestCollectInputSources(t *testing.T) {
+	stdin := strings.NewReader("input")
 	type args struct {
 		positionalArgs []string
 		stdin          io.Reader
@@ -411,7 +494,21 @@ func TestCollectInputSources(t *testing.T) {
 		want    []yup.InputSource
 		wantErr bool
 	}{
-		{},
+		{
+			name: "stdin",
+			args: args{stdin: stdin},
+			want: []yup.InputSource{{Reader: stdin, Filename: "stdin"}},
+		},
+		{
+			name: "dash is stdin",
+			args: args{positionalArgs: []string{"-", "-"}, stdin: stdin},
+			want: []yup.InputSource{{Reader: stdin, Filename: "stdin"}, {Reader: stdin, Filename: "stdin"}},
+		},
+		{
+			name:    "missing file",
+			args:    args{positionalArgs: []string{"-", "yup-no-such-file"}, stdin: stdin},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -440,7 +537,30 @@ func TestProcessSingleFile(t *testing.T) {
 		wantStderr string
 		wantErr    bool
 	}{
-		{},
+		{
+			name: "stdin",
+			args: args{stdin: strings.NewReader("input"), commandName: "wc", processor: func(r io.Reader, name string) error {
+				if name != "stdin" {
+					return errors.New("named " + name)
+				}
+				return nil
+			}},
+		},
+		{
+			name: "missing file",
+			args: args{positionalArgs: []string{"yup-no-such-file"}, commandName: "wc", processor: func(io.Reader, string) error {
+				return errors.New("processor called")
+			}},
+			wantStderr: "wc: yup-no-such-file: open yup-no-such-file: no such file or directory\n",
+			wantErr:    true,
+		},
+		{
+			name: "processor error",
+			args: args{stdin: strings.NewReader("input"), commandName: "wc", processor: func(io.Reader, string) error {
+				return errors.New("failed")
+			}},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -508,6 +628,9 @@ func TestRequireArguments(t *testing.T) {
 }
 
 func TestProcessSingleFileWithContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
 	type args struct {
 		ctx            context.Context
 		positionalArgs []string
@@ -521,7 +644,45 @@ func TestProcessSingleFileWithContext(t *testing.T) {
 		wantStderr string
 		wantErr    bool
 	}{
-		{},
+		{
+			name: "stdin",
+			args: args{ctx: context.Background(), stdin: strings.NewReader("input"), commandName: "wc",
+				processor: func(ctx context.Context, r io.Reader, name string) error {
+					data, err := io.ReadAll(r)
+					if err == nil && (name != "stdin" || string(data) != "input") {
+						err = errors.New("read " + string(data) + " from " + name)
+					}
+					return err
+				}},
+		},
+		{
+			name: "file from the context's filesystem",
+			args: args{ctx: yup.WithFS(context.Background(), fstest.MapFS{"in.txt": {Data: []byte("input")}}), positionalArgs: []string{"in.txt"}, commandName: "wc",
+				processor: func(ctx context.Context, r io.Reader, name string) error {
+					data, err := io.ReadAll(r)
+					if err == nil && (name != "in.txt" || string(data) != "input") {
+						err = errors.New("read " + string(data) + " from " + name)
+					}
+					return err
+				}},
+		},
+		{
+			name: "missing file",
+			args: args{ctx: yup.WithFS(context.Background(), fstest.MapFS{}), positionalArgs: []string{"in.txt"}, commandName: "wc",
+				processor: func(context.Context, io.Reader, string) error {
+					return errors.New("processor called")
+				}},
+			wantStderr: "wc: in.txt: open in.txt: file does not exist\n",
+			wantErr:    true,
+		},
+		{
+			name: "cancelled context",
+			args: args{ctx: cancelled, stdin: strings.NewReader("input"), commandName: "wc",
+				processor: func(context.Context, io.Reader, string) error {
+					return errors.New("processor called")
+				}},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -550,7 +711,21 @@ func TestProcessLinesSimple(t *testing.T) {
 		wantOutput string
 		wantErr    bool
 	}{
-		{},
+		{
+			name: "numbered",
+			args: args{ctx: context.Background(), reader: strings.NewReader("a\nb\n"), processor: func(ctx context.Context, lineNum int, line string, output io.Writer) error {
+				return numberLine(lineNum, line, output)
+			}},
+			wantOutput: "1 a\n2 b\n",
+		},
+		{
+			name: "capped",
+			args: args{ctx: yup.WithMaxLineLength(context.Background(), 3), reader: strings.NewReader("abc\nabcd\n"), processor: func(ctx context.Context, lineNum int, line string, output io.Writer) error {
+				return numberLine(lineNum, line, output)
+			}},
+			wantOutput: "1 abc\n",
+			wantErr:    true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
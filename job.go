@@ -0,0 +1,303 @@
+package yup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobState describes where a background job is in its life
+type JobState int
+
+const (
+	JobRunning  JobState = iota // Still executing
+	JobDone                     // Finished with status 0
+	JobFailed                   // Finished with a non-zero status
+	JobCanceled                 // Stopped by Cancel or its context
+)
+
+func (s JobState) String() string {
+	switch s {
+	case JobRunning:
+		return "Running"
+	case JobDone:
+		return "Done"
+	case JobFailed:
+		return "Exit"
+	case JobCanceled:
+		return "Terminated"
+	}
+	return fmt.Sprintf("JobState(%d)", int(s))
+}
+
+// Job is a pipeline running in the background, started with Pipeline.Start
+type Job struct {
+	ID int // Number in its JobTable, 0 until added to one
+
+	pipeline *Pipeline
+	started  time.Time
+	cancel   context.CancelFunc
+	counters []*stageCounters
+	done     chan struct{}
+
+	// Set before done is closed
+	result   *Result
+	err      error
+	canceled bool
+}
+
+// Start runs the pipeline in the background and returns a handle to it.
+// The job stops when ctx is done or Cancel is called.
+func (p *Pipeline) Start(ctx context.Context, input io.Reader, output, stderr io.Writer) *Job {
+	ctx, cancel := context.WithCancel(ctx)
+	job := &Job{
+		pipeline: p,
+		started:  time.Now(),
+		cancel:   cancel,
+		counters: make([]*stageCounters, len(p.commands)),
+		done:     make(chan struct{}),
+	}
+	for i := range job.counters {
+		job.counters[i] = &stageCounters{}
+	}
+
+	go func() {
+		defer cancel()
+		job.result, job.err = p.run(ctx, input, output, stderr, job.counters)
+		job.canceled = ctx.Err() != nil
+		close(job.done)
+	}()
+	return job
+}
+
+// Wait blocks until the job finishes and returns its outcome, as Run would
+func (j *Job) Wait() (*Result, error) {
+	<-j.done
+	return j.result, j.err
+}
+
+// Done returns a channel that is closed when the job finishes
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Cancel stops the job; Wait reports how its stages ended
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// State reports whether the job is running and, if not, how it ended
+func (j *Job) State() JobState {
+	select {
+	case <-j.done:
+	default:
+		return JobRunning
+	}
+	switch {
+	case j.canceled:
+		return JobCanceled
+	case ExitStatus(j.err) != StatusSuccess:
+		return JobFailed
+	}
+	return JobDone
+}
+
+// Stats reports the I/O each stage has performed so far
+func (j *Job) Stats() []StageStats {
+	stats := make([]StageStats, len(j.counters))
+	for i, c := range j.counters {
+		stats[i] = c.snapshot()
+	}
+	return stats
+}
+
+// Elapsed returns how long the job has been running
+func (j *Job) Elapsed() time.Duration {
+	return time.Since(j.started)
+}
+
+// Describe renders the job's pipeline
+func (j *Job) Describe() string {
+	return j.pipeline.Describe()
+}
+
+// JobTable tracks background jobs by number, providing the shell's jobs,
+// wait %n and kill %n
+type JobTable struct {
+	mu   sync.Mutex
+	jobs map[int]*Job
+	// Job numbers from least to most recently added, for %+ and %-
+	recent []int
+}
+
+// NewJobTable creates an empty job table
+func NewJobTable() *JobTable {
+	return &JobTable{jobs: map[int]*Job{}}
+}
+
+// Start runs p in the background and adds it to the table
+func (t *JobTable) Start(ctx context.Context, p *Pipeline, input io.Reader, output, stderr io.Writer) *Job {
+	job := p.Start(ctx, input, output, stderr)
+	t.Add(job)
+	return job
+}
+
+// Add assigns job the next job number and tracks it
+func (t *JobTable) Add(job *Job) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := 1
+	for n := range t.jobs {
+		if n >= id {
+			id = n + 1
+		}
+	}
+	job.ID = id
+	t.jobs[id] = job
+	t.recent = append(t.recent, id)
+	return id
+}
+
+// Jobs returns the tracked jobs ordered by number
+func (t *JobTable) Jobs() []*Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(t.jobs))
+	for _, job := range t.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].ID < jobs[k].ID })
+	return jobs
+}
+
+// Lookup resolves a job spec: %n or n for job n, %% or %+ for the current
+// job and %- for the previous one
+func (t *JobTable) Lookup(spec string) (*Job, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var id int
+	switch spec {
+	case "%%", "%+", "%":
+		if len(t.recent) == 0 {
+			return nil, fmt.Errorf("%s: no current job", spec)
+		}
+		id = t.recent[len(t.recent)-1]
+	case "%-":
+		if len(t.recent) < 2 {
+			return nil, fmt.Errorf("%s: no previous job", spec)
+		}
+		id = t.recent[len(t.recent)-2]
+	default:
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, "%"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: no such job", spec)
+		}
+		id = n
+	}
+
+	job, ok := t.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return job, nil
+}
+
+// Wait waits for the job named by spec and removes it from the table
+func (t *JobTable) Wait(spec string) (*Result, error) {
+	job, err := t.Lookup(spec)
+	if err != nil {
+		return nil, ExitWithError(StatusNotFound, err)
+	}
+	result, err := job.Wait()
+	t.remove(job.ID)
+	return result, err
+}
+
+// WaitAll waits for every tracked job and empties the table
+func (t *JobTable) WaitAll() {
+	for _, job := range t.Jobs() {
+		_, _ = job.Wait()
+		t.remove(job.ID)
+	}
+}
+
+// Kill cancels the job named by spec
+func (t *JobTable) Kill(spec string) error {
+	job, err := t.Lookup(spec)
+	if err != nil {
+		return ExitWithError(StatusFailure, err)
+	}
+	job.Cancel()
+	return nil
+}
+
+// List writes one line per job in the format of the shell's jobs builtin,
+// then forgets jobs that have finished, as the shell does once it has
+// reported them
+func (t *JobTable) List(w io.Writer) {
+	t.list(w, false)
+}
+
+// Notify writes the lines List would for jobs that have finished and forgets
+// them, as the shell does before printing a prompt
+func (t *JobTable) Notify(w io.Writer) {
+	t.list(w, true)
+}
+
+func (t *JobTable) list(w io.Writer, finishedOnly bool) {
+	jobs := t.Jobs()
+
+	t.mu.Lock()
+	current, previous := 0, 0
+	if n := len(t.recent); n > 0 {
+		current = t.recent[n-1]
+		if n > 1 {
+			previous = t.recent[n-2]
+		}
+	}
+	t.mu.Unlock()
+
+	for _, job := range jobs {
+		mark := " "
+		switch job.ID {
+		case current:
+			mark = "+"
+		case previous:
+			mark = "-"
+		}
+
+		state := job.State()
+		if finishedOnly && state == JobRunning {
+			continue
+		}
+		label := state.String()
+		if state == JobFailed {
+			label = fmt.Sprintf("Exit %d", ExitStatus(job.err))
+		}
+		_, _ = fmt.Fprintf(w, "[%d]%s  %-24s%s\n", job.ID, mark, label, job.Describe())
+
+		if state != JobRunning {
+			t.remove(job.ID)
+		}
+	}
+}
+
+func (t *JobTable) remove(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.jobs, id)
+	for i, n := range t.recent {
+		if n == id {
+			t.recent = append(t.recent[:i], t.recent[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	yup "github.com/yupsh/framework"
+)
+
+func TestJob(t *testing.T) {
+	t.Run("wait and stats", func(t *testing.T) {
+		var output strings.Builder
+		job := yup.Pipe(passthrough, passthrough).Start(context.Background(), strings.NewReader("a\nb\n"), &output, io.Discard)
+		result, err := job.Wait()
+		if err != nil || output.String() != "a\nb\n" {
+			t.Fatalf("Got output %q, err %v", output.String(), err)
+		}
+		if got := result.PipeStatus(); len(got) != 2 {
+			t.Errorf("Expected 2 stage statuses, got %v", got)
+		}
+		if job.State() != yup.JobDone {
+			t.Errorf("Expected Done, got %v", job.State())
+		}
+		if stats := job.Stats(); stats[1].LinesWritten != 2 || stats[0].BytesRead != 4 {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		block := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		job := yup.Pipe(block).Start(context.Background(), strings.NewReader(""), io.Discard, io.Discard)
+		if job.State() != yup.JobRunning {
+			t.Errorf("Expected Running, got %v", job.State())
+		}
+		job.Cancel()
+		select {
+		case <-job.Done():
+		case <-time.After(time.Second):
+			t.Fatal("Job did not stop after Cancel")
+		}
+		if _, err := job.Wait(); !errors.Is(err, context.Canceled) || job.State() != yup.JobCanceled {
+			t.Errorf("Expected cancellation, got %v in state %v", err, job.State())
+		}
+	})
+}
+
+func TestJobTable(t *testing.T) {
+	table := yup.NewJobTable()
+	release := make(chan struct{})
+	wait := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		select {
+		case <-release:
+			return yup.Exit(3)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	first := table.Start(context.Background(), yup.Pipe(wait), strings.NewReader(""), io.Discard, io.Discard)
+	second := table.Start(context.Background(), yup.Pipe(wait), strings.NewReader(""), io.Discard, io.Discard)
+	if first.ID != 1 || second.ID != 2 {
+		t.Fatalf("Expected jobs 1 and 2, got %d and %d", first.ID, second.ID)
+	}
+	if job, _ := table.Lookup("%-"); job != first {
+		t.Errorf("Expected %%- to be job 1")
+	}
+	if job, _ := table.Lookup("%%"); job != second {
+		t.Errorf("Expected %%%% to be job 2")
+	}
+
+	if err := table.Kill("%1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := table.Wait("%1"); yup.ExitStatus(err) != yup.StatusCanceled {
+		t.Errorf("Expected killed job to report status 130, got %v", err)
+	}
+	if _, err := table.Wait("%1"); yup.ExitStatus(err) != yup.StatusNotFound {
+		t.Errorf("Expected waited job to be gone, got %v", err)
+	}
+
+	var listing strings.Builder
+	table.List(&listing)
+	if !strings.HasPrefix(listing.String(), "[2]+  Running") {
+		t.Errorf("Unexpected jobs listing %q", listing.String())
+	}
+
+	close(release)
+	if _, err := table.Wait("2"); yup.ExitStatus(err) != 3 {
+		t.Errorf("Expected status 3, got %v", err)
+	}
+	if jobs := table.Jobs(); len(jobs) != 0 {
+		t.Errorf("Expected empty table, got %d jobs", len(jobs))
+	}
+}
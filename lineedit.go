@@ -0,0 +1,251 @@
+package yup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrInterrupted is returned by LineEditor.ReadLine when the user presses
+// Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// LineEditor reads lines from a terminal in raw mode, echoing and editing
+// them itself. It understands the usual Emacs-style keys: arrows, Home and
+// End, Ctrl-A/E/B/F to move, Backspace, Delete, Ctrl-D, Ctrl-K/U/W to
+// delete, Ctrl-L to clear the screen, Up and Down for history and Tab to
+// complete.
+type LineEditor struct {
+	// History is recalled with Up and Down, oldest first
+	History []string
+
+	// Complete is called on Tab with the text left of the cursor. It returns
+	// the trailing part of that text being completed and the words that
+	// could replace it.
+	Complete func(head string) (word string, candidates []string)
+
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewLineEditor creates an editor reading keys from in and drawing on out
+func NewLineEditor(in io.Reader, out io.Writer) *LineEditor {
+	return &LineEditor{in: bufio.NewReader(in), out: out}
+}
+
+// lineState is the line being edited
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int // Cursor position in buf
+}
+
+// ReadLine shows prompt and returns the line entered, without its newline.
+// It returns io.EOF for Ctrl-D on an empty line or the end of input and
+// ErrInterrupted for Ctrl-C.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	l := &lineState{prompt: prompt}
+	e.refresh(l)
+
+	history := e.History
+	hist := len(history) // Index of the history entry shown; len for the new line
+	var saved []rune     // The new line while browsing history
+	lastWasTab := false
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(l.buf) > 0 {
+				e.write("\r\n")
+				return string(l.buf), nil
+			}
+			return "", err
+		}
+		tab := r == '\t'
+
+		switch r {
+		case '\r', '\n':
+			e.write("\r\n")
+			return string(l.buf), nil
+		case ctrl('C'):
+			e.write("^C\r\n")
+			return "", ErrInterrupted
+		case ctrl('D'):
+			if len(l.buf) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			l.deleteAt(l.pos)
+		case ctrl('A'):
+			l.pos = 0
+		case ctrl('E'):
+			l.pos = len(l.buf)
+		case ctrl('B'):
+			l.pos = max(l.pos-1, 0)
+		case ctrl('F'):
+			l.pos = min(l.pos+1, len(l.buf))
+		case ctrl('K'):
+			l.buf = l.buf[:l.pos]
+		case ctrl('U'):
+			l.buf = append(l.buf[:0], l.buf[l.pos:]...)
+			l.pos = 0
+		case ctrl('W'):
+			start := l.pos
+			for start > 0 && l.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && l.buf[start-1] != ' ' {
+				start--
+			}
+			l.buf = append(l.buf[:start], l.buf[l.pos:]...)
+			l.pos = start
+		case ctrl('L'):
+			e.write("\x1b[H\x1b[2J")
+		case ctrl('H'), 0x7f:
+			if l.pos > 0 {
+				l.pos--
+				l.deleteAt(l.pos)
+			}
+		case ctrl('P'), ctrl('N'):
+			hist, saved = e.browse(l, history, hist, saved, r == ctrl('P'))
+		case '\t':
+			e.complete(l, lastWasTab)
+		case 0x1b:
+			switch e.readEscape() {
+			case "A":
+				hist, saved = e.browse(l, history, hist, saved, true)
+			case "B":
+				hist, saved = e.browse(l, history, hist, saved, false)
+			case "C":
+				l.pos = min(l.pos+1, len(l.buf))
+			case "D":
+				l.pos = max(l.pos-1, 0)
+			case "H", "1~", "7~":
+				l.pos = 0
+			case "F", "4~", "8~":
+				l.pos = len(l.buf)
+			case "3~":
+				l.deleteAt(l.pos)
+			}
+		default:
+			if r >= ' ' {
+				l.insert([]rune{r})
+			}
+		}
+		lastWasTab = tab
+		e.refresh(l)
+	}
+}
+
+// browse moves through history, keeping the new line to come back to
+func (e *LineEditor) browse(l *lineState, history []string, hist int, saved []rune, older bool) (int, []rune) {
+	switch {
+	case older && hist > 0:
+		if hist == len(history) {
+			saved = append([]rune(nil), l.buf...)
+		}
+		hist--
+		l.buf = []rune(history[hist])
+	case !older && hist < len(history):
+		hist++
+		if hist == len(history) {
+			l.buf = saved
+		} else {
+			l.buf = []rune(history[hist])
+		}
+	}
+	l.pos = len(l.buf)
+	return hist, saved
+}
+
+// complete inserts what the candidates for the word before the cursor
+// have in common, listing them when that adds nothing on a repeated Tab
+func (e *LineEditor) complete(l *lineState, list bool) {
+	if e.Complete == nil {
+		return
+	}
+	word, candidates := e.Complete(string(l.buf[:l.pos]))
+	if len(candidates) == 0 {
+		return
+	}
+
+	// Trim rune by rune, so that a shared first byte of two different
+	// characters is not taken for a common prefix
+	common := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		n := 0
+		for _, r := range c {
+			if n == len(common) || common[n] != r {
+				break
+			}
+			n++
+		}
+		common = common[:n]
+	}
+	if len(candidates) == 1 && !strings.HasSuffix(string(common), "/") {
+		common = append(common, ' ')
+	}
+
+	if string(common) != word {
+		n := len([]rune(word))
+		start := max(l.pos-n, 0)
+		l.buf = append(l.buf[:start], l.buf[l.pos:]...)
+		l.pos = start
+		l.insert(common)
+		return
+	}
+	if list {
+		e.write("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+	}
+}
+
+// readEscape reads the rest of an escape sequence and returns its
+// parameters and final byte, e.g. "A" for ESC [ A or "3~" for ESC [ 3 ~
+func (e *LineEditor) readEscape() string {
+	introducer, err := e.in.ReadByte()
+	if err != nil || (introducer != '[' && introducer != 'O') {
+		return ""
+	}
+	var seq []byte
+	for {
+		b, err := e.in.ReadByte()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, b)
+		if b >= 0x40 && b <= 0x7e {
+			return string(seq)
+		}
+	}
+}
+
+// refresh redraws the line and places the cursor
+func (e *LineEditor) refresh(l *lineState) {
+	line := "\r" + l.prompt + string(l.buf) + "\x1b[K"
+	if back := len(l.buf) - l.pos; back > 0 {
+		line += fmt.Sprintf("\x1b[%dD", back)
+	}
+	e.write(line)
+}
+
+func (e *LineEditor) write(s string) {
+	_, _ = io.WriteString(e.out, s)
+}
+
+func (l *lineState) insert(runes []rune) {
+	l.buf = append(l.buf[:l.pos], append(runes, l.buf[l.pos:]...)...)
+	l.pos += len(runes)
+}
+
+func (l *lineState) deleteAt(i int) {
+	if i < len(l.buf) {
+		l.buf = append(l.buf[:i], l.buf[i+1:]...)
+	}
+}
+
+// ctrl returns the character typed with the Control key held
+func ctrl(r rune) rune {
+	return r & 0x1f
+}
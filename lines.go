@@ -0,0 +1,81 @@
+package yup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// LineTooLongError is the error for a line longer than the cap set with
+// WithMaxLineLength. File helpers report it with the file's name, as in
+// "grep: big.json: line 1: longer than 1048576 bytes".
+type LineTooLongError struct {
+	Line int // 1-based number of the line
+	Max  int // The cap it exceeded, in bytes
+}
+
+func (e *LineTooLongError) Error() string {
+	return fmt.Sprintf("line %d: longer than %d bytes", e.Line, e.Max)
+}
+
+// Unwrap lets errors.Is match bufio.ErrTooLong
+func (e *LineTooLongError) Unwrap() error {
+	return bufio.ErrTooLong
+}
+
+type maxLineKey struct{}
+
+// WithMaxLineLength returns a context whose line helpers fail with a
+// LineTooLongError on lines longer than max bytes, not counting the line
+// terminator. Without a cap a line may be any length, holding only the
+// longest line in memory at once.
+func WithMaxLineLength(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, maxLineKey{}, max)
+}
+
+// maxLineLength returns ctx's line cap, or 0 for none
+func maxLineLength(ctx context.Context) int {
+	max, _ := ctx.Value(maxLineKey{}).(int)
+	return max
+}
+
+// NewScanner returns a scanner of the lines of r without the 64 KiB limit
+// of bufio.NewScanner: lines may be as long as ctx's cap, or any length.
+// Use it with ScanWithContext.
+func NewScanner(ctx context.Context, r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	size := math.MaxInt
+	if max := maxLineLength(ctx); max > 0 {
+		// Room for the terminator, which ScanLines needs to see
+		size = max + len("\r\n")
+	}
+	scanner.Buffer(nil, size)
+	return scanner
+}
+
+// scanLines calls fn with each line of reader, numbered from 1, enforcing
+// ctx's cap
+func scanLines(ctx context.Context, reader io.Reader, fn func(lineNum int, line string) error) error {
+	scanner := NewScanner(ctx, reader)
+	max := maxLineLength(ctx)
+	lineNum := 1
+
+	for scanner.Scan() {
+		if max > 0 && len(scanner.Bytes()) > max {
+			return &LineTooLongError{Line: lineNum, Max: max}
+		}
+		if err := fn(lineNum, scanner.Text()); err != nil {
+			return err
+		}
+		lineNum++
+	}
+
+	err := scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) && max > 0 {
+		return &LineTooLongError{Line: lineNum, Max: max}
+	}
+	return err
+}
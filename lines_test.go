@@ -0,0 +1,64 @@
+package yup_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	yup "github.com/yupsh/framework"
+)
+
+func TestNewScanner(t *testing.T) {
+	long := strings.Repeat("x", 200*1024)
+	scanner := yup.NewScanner(context.Background(), strings.NewReader("a\n"+long+"\nb"))
+	var lines []string
+	for yup.ScanWithContext(context.Background(), scanner) {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil || len(lines) != 3 || lines[1] != long {
+		t.Errorf("Got %d lines, err %v", len(lines), err)
+	}
+
+	// The cap leaves room for a CRLF terminator
+	ctx := yup.WithMaxLineLength(context.Background(), 4)
+	scanner = yup.NewScanner(ctx, strings.NewReader("abcd\r\nabcdefgh\n"))
+	if !scanner.Scan() || scanner.Text() != "abcd" {
+		t.Errorf("Got %q, err %v", scanner.Text(), scanner.Err())
+	}
+	if scanner.Scan() || !errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		t.Errorf("Expected bufio.ErrTooLong, got %q, %v", scanner.Text(), scanner.Err())
+	}
+}
+
+func TestMaxLineLength(t *testing.T) {
+	ctx := yup.WithFS(context.Background(), fstest.MapFS{
+		"small.json": {Data: []byte("{}\n")},
+		"big.json":   {Data: []byte("{}\n{}\n" + strings.Repeat("x", 100) + "\n")},
+	})
+	ctx = yup.WithMaxLineLength(ctx, 64)
+
+	var output, stderr strings.Builder
+	options := yup.FileProcessorOptions{CommandName: "grep", ContinueOnError: true}
+	err := yup.ProcessFilesWithContext(ctx, []string{"big.json", "small.json"}, nil, &output, &stderr, options,
+		func(ctx context.Context, source yup.InputSource, output io.Writer) error {
+			return yup.ProcessLinesWithContext(ctx, source.Reader, output, func(ctx context.Context, lineNum int, line string, output io.Writer) error {
+				_, err := io.WriteString(output, line+"\n")
+				return err
+			})
+		})
+
+	var tooLong *yup.LineTooLongError
+	if !errors.As(err, &tooLong) || tooLong.Line != 3 || !errors.Is(err, bufio.ErrTooLong) {
+		t.Errorf("Expected a LineTooLongError for line 3, got %v", err)
+	}
+	if want := "grep: big.json: line 3: longer than 64 bytes\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+	if want := "{}\n{}\n{}\n"; output.String() != want {
+		t.Errorf("output = %q, want %q", output.String(), want)
+	}
+}
@@ -0,0 +1,99 @@
+package yup
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// listOp is the operator joining the commands of a list
+type listOp string
+
+const (
+	opAnd listOp = " && "
+	opOr  listOp = " || "
+	opSeq listOp = "; "
+)
+
+// commandList runs commands one after another, like a shell command list
+type commandList struct {
+	op       listOp
+	commands []Command
+}
+
+// And runs commands in order while each succeeds, like the shell's &&. It
+// returns the error of the last command that ran.
+func And(commands ...Command) Command {
+	return &commandList{op: opAnd, commands: commands}
+}
+
+// Or runs commands in order until one succeeds, like the shell's ||. It
+// returns the error of the last command that ran.
+func Or(commands ...Command) Command {
+	return &commandList{op: opOr, commands: commands}
+}
+
+// Seq runs every command in order regardless of status, like the shell's ;
+// It returns the error of the last command.
+func Seq(commands ...Command) Command {
+	return &commandList{op: opSeq, commands: commands}
+}
+
+// Execute runs the list; every command shares stdin, stdout and stderr
+func (l *commandList) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	ctx, share, done := shareStdin(ctx, stdin)
+	defer done()
+
+	var err error
+	for i, cmd := range l.commands {
+		if i > 0 {
+			status := ExitStatus(err)
+			if l.op == opAnd && status != StatusSuccess {
+				break
+			}
+			if l.op == opOr && status == StatusSuccess {
+				break
+			}
+		}
+
+		// Like an interrupted shell, stop starting new commands
+		if cerr := CheckContextCancellation(ctx); cerr != nil {
+			return cerr
+		}
+
+		err = cmd.Execute(ctx, share.reader(), stdout, stderr)
+	}
+	return err
+}
+
+// Describe renders the list with its shell operator, grouping nested lists
+// with braces where precedence would otherwise change their meaning
+func (l *commandList) Describe() string {
+	parts := make([]string, len(l.commands))
+	for i, cmd := range l.commands {
+		inner, ok := cmd.(*commandList)
+		switch {
+		case !ok || inner.op == l.op:
+			parts[i] = Describe(cmd)
+		case i == 0 && l.op != opSeq && inner.op != opSeq:
+			// && and || are left-associative with equal precedence
+			parts[i] = Describe(cmd)
+		default:
+			parts[i] = group(cmd)
+		}
+	}
+	return strings.Join(parts, string(l.op))
+}
+
+// describeStage renders cmd as a pipeline stage, grouping command lists
+func describeStage(cmd Command) string {
+	if _, ok := cmd.(*commandList); ok {
+		return group(cmd)
+	}
+	return Describe(cmd)
+}
+
+// group wraps a command in a brace group
+func group(cmd Command) string {
+	return "{ " + Describe(cmd) + "; }"
+}
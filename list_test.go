@@ -0,0 +1,59 @@
+package yup_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+)
+
+// echo writes its word and exits with status
+func echo(word string, status int) yup.Command {
+	return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		_, _ = fmt.Fprintln(stdout, word)
+		return yup.Exit(status)
+	})
+}
+
+func TestCommandLists(t *testing.T) {
+	tests := []struct {
+		name       string
+		cmd        yup.Command
+		wantOutput string
+		wantStatus int
+	}{
+		{"and runs while successful", yup.And(echo("a", 0), echo("b", 0)), "a\nb\n", 0},
+		{"and short-circuits on failure", yup.And(echo("a", 1), echo("b", 0)), "a\n", 1},
+		{"or stops at first success", yup.Or(echo("a", 0), echo("b", 0)), "a\n", 0},
+		{"or tries alternatives", yup.Or(echo("a", 2), echo("b", 0)), "a\nb\n", 0},
+		{"seq runs everything", yup.Seq(echo("a", 1), echo("b", 3)), "a\nb\n", 3},
+		{"grouped lists", yup.Or(yup.And(echo("a", 0), echo("b", 1)), echo("c", 0)), "a\nb\nc\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output strings.Builder
+			err := tt.cmd.Execute(context.Background(), strings.NewReader(""), &output, io.Discard)
+			if output.String() != tt.wantOutput {
+				t.Errorf("Execute() output = %q, want %q", output.String(), tt.wantOutput)
+			}
+			if got := yup.ExitStatus(err); got != tt.wantStatus {
+				t.Errorf("Execute() status = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func ExampleAnd() {
+	cat := grepCommand{yup.StandardCommand[grepFlags]{Name: "cat", Positional: []string{"a.txt"}}}
+	wc := grepCommand{yup.StandardCommand[grepFlags]{Name: "wc"}}
+	test := grepCommand{yup.StandardCommand[grepFlags]{Name: "test", Positional: []string{"-f", "a.txt"}}}
+
+	fmt.Println(yup.Describe(yup.And(test, yup.Seq(cat, wc))))
+	fmt.Println(yup.Describe(yup.Pipe(yup.Or(test, cat), wc)))
+	// Output:
+	// test -- -f a.txt && { cat a.txt; wc; }
+	// { test -- -f a.txt || cat a.txt; } | wc
+}
@@ -0,0 +1,177 @@
+package yup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Main is the entry point of a multi-call binary: one executable holding
+// every command in registry, in the manner of busybox. It runs the command
+// named by the program name, so a symlink called grep runs grep, or else by
+// the first argument, as in "yup grep foo". SIGINT and SIGTERM cancel the
+// command's context, and the process exits with the command's status.
+// Invoked as yupsh, it runs the interactive Shell instead.
+func Main(registry *Registry) {
+	// The shell handles interrupts itself, cancelling only the foreground
+	// command
+	if _, ok := shellArgs(registry, os.Args); ok {
+		os.Exit(Dispatch(context.Background(), registry, os.Args, os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	ctx, stop := signalContext(context.Background())
+	status := Dispatch(ctx, registry, os.Args, os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(status)
+}
+
+// Dispatch is Main without the process: it picks the command for argv,
+// runs it and returns the exit status. Commands report their own errors;
+// Dispatch only reports those it finds itself. Besides command names the
+// multi-call name accepts --list, which prints every command for creating
+// symlinks, --help, and yupsh, which starts the shell.
+func Dispatch(ctx context.Context, registry *Registry, argv []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if args, ok := shellArgs(registry, argv); ok {
+		return runShell(ctx, registry, args, stdin, stdout, stderr)
+	}
+
+	self := "yup"
+	if len(argv) > 0 {
+		self = strings.TrimSuffix(filepath.Base(argv[0]), ".exe")
+		if spec, ok := registry.Lookup(self); ok {
+			return runSpec(ctx, spec, argv[1:], stdin, stdout, stderr)
+		}
+		argv = argv[1:]
+	}
+
+	if len(argv) == 0 {
+		multiCallUsage(stderr, self, registry)
+		return StatusUsage
+	}
+	switch argv[0] {
+	case "--help":
+		multiCallUsage(stdout, self, registry)
+		return StatusSuccess
+	case "--list":
+		for _, name := range registry.Names("") {
+			_, _ = fmt.Fprintln(stdout, name)
+		}
+		return StatusSuccess
+	}
+
+	spec, ok := registry.Lookup(argv[0])
+	if !ok {
+		_, _ = fmt.Fprintf(stderr, "%s: %s: command not found\n", self, argv[0])
+		return StatusNotFound
+	}
+	return runSpec(ctx, spec, argv[1:], stdin, stdout, stderr)
+}
+
+// shellArgs reports whether argv asks for the shell, by program name or
+// first argument, and returns the shell's own arguments
+func shellArgs(registry *Registry, argv []string) ([]string, bool) {
+	if len(argv) == 0 {
+		return nil, false
+	}
+	if _, ok := registry.Lookup(shellName); ok {
+		return nil, false
+	}
+	if strings.TrimSuffix(filepath.Base(argv[0]), ".exe") == shellName {
+		return argv[1:], true
+	}
+	if len(argv) > 1 && argv[1] == shellName {
+		return argv[2:], true
+	}
+	return nil, false
+}
+
+// shellName is the name under which the multi-call binary is the shell
+const shellName = "yupsh"
+
+// runShell runs the shell: interactively, or on one line given with -c
+func runShell(ctx context.Context, registry *Registry, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	sh := NewShell(registry)
+	sh.Stdin, sh.Stdout, sh.Stderr = stdin, stdout, stderr
+
+	switch {
+	case len(args) == 2 && args[0] == "-c":
+		defer sh.stopJobs()
+		return sh.Exec(ctx, args[1])
+	case len(args) > 0:
+		_, _ = fmt.Fprintf(stderr, "Usage: %s [-c COMMAND]\n", shellName)
+		return StatusUsage
+	}
+
+	if file, ok := stdin.(*os.File); ok && isTerminal(file.Fd()) {
+		if home, err := os.UserHomeDir(); err == nil {
+			sh.HistoryFile = filepath.Join(home, ".yupsh_history")
+		}
+	}
+	return sh.Run(ctx)
+}
+
+// runSpec builds and runs one command, translating its error to a status
+func runSpec(ctx context.Context, spec Spec, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	err := spec.Construct(args).Execute(ctx, stdin, stdout, stderr)
+
+	var sig *signalError
+	if errors.As(context.Cause(ctx), &sig) && ctx.Err() != nil {
+		return 128 + sig.number
+	}
+	return ExitStatus(err)
+}
+
+// multiCallUsage lists the commands of a multi-call binary
+func multiCallUsage(w io.Writer, self string, registry *Registry) {
+	_, _ = fmt.Fprintf(w, "Usage: %s COMMAND [ARG]...\n", self)
+	_, _ = fmt.Fprintf(w, "   or: COMMAND [ARG]...  (with %s linked as COMMAND)\n\n", self)
+	_, _ = fmt.Fprintln(w, "Commands:")
+	for _, spec := range registry.Specs() {
+		_, _ = fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("  %-12s %s", spec.Name, spec.Synopsis), " "))
+	}
+}
+
+// signalError is the cancellation cause when a signal stops the command
+type signalError struct {
+	number int
+	sig    os.Signal
+}
+
+func (e *signalError) Error() string {
+	return "received " + e.sig.String()
+}
+
+// signalContext returns a context cancelled by the first SIGINT or
+// SIGTERM. A second signal gets its default action, so a command that
+// ignores cancellation can still be interrupted.
+func signalContext(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			number := 0
+			if s, ok := sig.(syscall.Signal); ok {
+				number = int(s)
+			}
+			signal.Stop(signals)
+			cancel(&signalError{number: number, sig: sig})
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		close(done)
+		signal.Stop(signals)
+		cancel(context.Canceled)
+	}
+}
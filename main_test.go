@@ -0,0 +1,135 @@
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	yup "github.com/yupsh/framework"
+	"github.com/yupsh/framework/opt"
+)
+
+// multiCall is the registry of the test binary's multi-call mode
+func multiCall() *yup.Registry {
+	registry := yup.NewRegistry()
+	registry.Register(yup.Spec{Name: "echo", New: argv, Synopsis: "Write arguments to standard output."})
+	registry.Register(yup.Spec{Name: "fail", New: func(...any) yup.Command { return exitWith(3) }})
+	registry.Register(yup.Spec{
+		Name: "search",
+		New: func(parameters ...any) yup.Command {
+			args := opt.Args[string, searchFlags](parameters...)
+			return searchCommand{yup.StandardCommand[searchFlags]{Name: "search", Positional: args.Positional, Flags: args.Flags}}
+		},
+		Synopsis: "Search for PATTERN in each FILE.",
+		Flags:    opt.FlagsOf[searchFlags](),
+		Argv:     opt.Argv[searchFlags],
+	})
+	registry.Register(yup.Spec{Name: "wait", New: waitForCancel})
+	return registry
+}
+
+// waitForCancel runs until its context is cancelled
+func waitForCancel(...any) yup.Command {
+	return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		_, _ = io.WriteString(stdout, "waiting\n")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+}
+
+// TestMain lets the test binary act as a multi-call binary for
+// TestMainSignal
+func TestMain(m *testing.M) {
+	if os.Getenv("YUP_TEST_MULTI_CALL") == "1" {
+		yup.Main(multiCall())
+	}
+	os.Exit(m.Run())
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		argv       []string
+		wantStatus int
+		wantStdout string
+		wantStderr string
+	}{
+		{"by program name", []string{"/usr/bin/echo", "a", "b"}, 0, "a\nb\n", ""},
+		{"by windows program name", []string{`echo.exe`, "a"}, 0, "a\n", ""},
+		{"by first argument", []string{"/bin/yup", "echo", "a"}, 0, "a\n", ""},
+		{"exit status", []string{"yup", "fail"}, 3, "", ""},
+		{"unknown command", []string{"yup", "nosuch"}, yup.StatusNotFound, "", "yup: nosuch: command not found\n"},
+		{"usage error", []string{"search", "-x"}, yup.StatusUsage, "", "search: invalid option -- 'x'\nTry 'search --help' for more information.\n"},
+		{"command help", []string{"yup", "search", "--help"}, 0, "Usage: search [OPTION]...\nSearch for PATTERN in each FILE.\n", ""},
+		{"list", []string{"yup", "--list"}, 0, "echo\nfail\nsearch\nwait\n", ""},
+		{"no command", []string{"yup"}, yup.StatusUsage, "", "Usage: yup COMMAND [ARG]...\n"},
+		{"help", []string{"yup", "--help"}, 0, "Usage: yup COMMAND [ARG]...\n" +
+			"   or: COMMAND [ARG]...  (with yup linked as COMMAND)\n\n" +
+			"Commands:\n" +
+			"  echo         Write arguments to standard output.\n" +
+			"  fail\n" +
+			"  search       Search for PATTERN in each FILE.\n" +
+			"  wait\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			status := yup.Dispatch(context.Background(), multiCall(), tt.argv, strings.NewReader(""), &stdout, &stderr)
+			if status != tt.wantStatus {
+				t.Errorf("Dispatch() = %d, want %d", status, tt.wantStatus)
+			}
+			if !strings.HasPrefix(stdout.String(), tt.wantStdout) || (tt.wantStdout == "") != (stdout.Len() == 0) {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+			if !strings.HasPrefix(stderr.String(), tt.wantStderr) || (tt.wantStderr == "") != (stderr.Len() == 0) {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestMainSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs SIGTERM")
+	}
+
+	cmd := exec.Command(os.Args[0], "wait")
+	cmd.Env = append(os.Environ(), "YUP_TEST_MULTI_CALL=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signal once the command is running
+	buf := make([]byte, len("waiting\n"))
+	if _, err := io.ReadFull(stdout, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("process did not exit after SIGTERM")
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 128+int(syscall.SIGTERM) {
+		t.Errorf("Wait() = %v, want exit status %d", err, 128+int(syscall.SIGTERM))
+	}
+}
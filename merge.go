@@ -0,0 +1,195 @@
+package yup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Concat runs commands concurrently and writes their outputs one after
+// another in argument order, like `cat <(a) <(b)`. Output of later commands
+// is buffered, overflowing to a temporary file, until its turn comes.
+// Commands are sources: they read no input. Under a Scheduler they start in
+// argument order, as many at a time as it allows.
+func Concat(commands ...Command) Command {
+	return &fanIn{commands: commands, interleave: false}
+}
+
+// Interleave runs commands concurrently and merges their outputs line by
+// line as lines arrive. A line is always written whole, never torn across
+// sources; a final line without a newline is terminated with one when its
+// command returns, so it cannot run into another source's line. Commands
+// are sources: they read no input.
+func Interleave(commands ...Command) Command {
+	return &fanIn{commands: commands, interleave: true}
+}
+
+// fanIn merges the outputs of several commands into one stream
+type fanIn struct {
+	commands   []Command
+	interleave bool
+}
+
+func (f *fanIn) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(f.commands) == 0 {
+		return nil
+	}
+
+	ctx, release, err := acquireFanOut(ctx, 1)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	stderr = &lockedWriter{w: stderr}
+	errs := make([]error, len(f.commands))
+
+	if f.interleave {
+		out := &lockedWriter{w: stdout}
+		f.each(ctx, func(i int) {
+			lines := &lineWriter{w: out}
+			errs[i] = f.commands[i].Execute(ctx, strings.NewReader(""), lines, stderr)
+			if err := lines.flush(); err != nil && errs[i] == nil {
+				errs[i] = err
+			}
+		})
+		return rightmostError(errs)
+	}
+
+	// Writers never block, since the pipes spill, so sources waiting their
+	// turn can only be held up by the scheduler, never by the copy below
+	pipes := make([]*ringPipe, len(f.commands))
+	for i := range pipes {
+		pipes[i] = newRingPipe(DefaultBufferSize, true)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.each(ctx, func(i int) {
+			errs[i] = f.commands[i].Execute(ctx, strings.NewReader(""), ringPipeWriter{pipes[i]}, stderr)
+			pipes[i].closeWrite(nil)
+		})
+	}()
+
+	var copyErr error
+	for _, pipe := range pipes {
+		if copyErr == nil {
+			_, copyErr = io.Copy(stdout, ringPipeReader{pipe})
+		}
+		// Once stdout fails, the remaining commands see a broken pipe
+		pipe.closeRead(ErrBrokenPipe)
+	}
+	<-done
+
+	if copyErr != nil {
+		return copyErr
+	}
+	return rightmostError(errs)
+}
+
+// each calls run for every command, starting them in argument order and
+// running as many at once as the scheduler in ctx allows. The fan-in's own
+// slot keeps running commands while the others wait, so every command gets
+// its turn even if no further slot frees up.
+func (f *fanIn) each(ctx context.Context, run func(i int)) {
+	var wg sync.WaitGroup
+	sched := SchedulerFrom(ctx)
+	if sched == nil {
+		for i := range f.commands {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+		return
+	}
+
+	var next atomic.Int64
+	work := func() {
+		for i := int(next.Add(1)) - 1; i < len(f.commands); i = int(next.Add(1)) - 1 {
+			run(i)
+		}
+	}
+
+	// Slots are only worth waiting for while commands remain to start
+	waitCtx, stop := context.WithCancel(ctx)
+	for n := 1; n < len(f.commands); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := sched.acquireSource(waitCtx)
+			if err != nil {
+				return
+			}
+			defer release()
+			work()
+		}()
+	}
+	work()
+	stop()
+	wg.Wait()
+}
+
+// Describe renders the merge as an equivalent shell construct
+func (f *fanIn) Describe() string {
+	parts := make([]string, len(f.commands))
+	for i, cmd := range f.commands {
+		parts[i] = Describe(cmd)
+	}
+	if f.interleave {
+		return "{ " + strings.Join(parts, " & ") + " & wait; }"
+	}
+	return "cat <(" + strings.Join(parts, ") <(") + ")"
+}
+
+// rightmostError reports the last failure like PipeFail does, treating
+// broken pipes as clean exits
+func rightmostError(errs []error) error {
+	for i := len(errs) - 1; i >= 0; i-- {
+		if result := stageResult(errs[i]); result.failed() {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+// lineWriter forwards only complete lines, holding back a partial line
+// until the rest of it arrives
+type lineWriter struct {
+	w       io.Writer
+	partial []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	last := bytes.LastIndexByte(p, '\n')
+	if last < 0 {
+		l.partial = append(l.partial, p...)
+		return len(p), nil
+	}
+
+	lines := p[:last+1]
+	if len(l.partial) > 0 {
+		lines = append(l.partial, lines...)
+		l.partial = nil
+	}
+	if _, err := l.w.Write(lines); err != nil {
+		return 0, err
+	}
+	l.partial = append(l.partial, p[last+1:]...)
+	return len(p), nil
+}
+
+// flush writes out a trailing line that has no newline, terminating it
+func (l *lineWriter) flush() error {
+	if len(l.partial) == 0 {
+		return nil
+	}
+	_, err := l.w.Write(append(l.partial, '\n'))
+	l.partial = nil
+	return err
+}
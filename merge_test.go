@@ -0,0 +1,71 @@
+package yup_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+)
+
+// chunked writes each line of text in tiny pieces to provoke tearing
+func chunked(text string, piece int) yup.Command {
+	return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		for len(text) > 0 {
+			n := min(piece, len(text))
+			if _, err := io.WriteString(stdout, text[:n]); err != nil {
+				return err
+			}
+			text = text[n:]
+		}
+		return nil
+	})
+}
+
+func TestConcat(t *testing.T) {
+	a := strings.Repeat("a\n", 50000)
+	b := "b1\nb2"
+	var output strings.Builder
+	err := yup.Concat(chunked(a, 7), chunked(b, 1), exitWith(0)).
+		Execute(context.Background(), strings.NewReader(""), &output, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output.String() != a+b {
+		t.Errorf("Outputs out of order or incomplete (%d bytes)", output.Len())
+	}
+
+	err = yup.Concat(exitWith(2), exitWith(0)).Execute(context.Background(), strings.NewReader(""), io.Discard, io.Discard)
+	if got := yup.ExitStatus(err); got != 2 {
+		t.Errorf("Expected status 2, got %d", got)
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	var sources []yup.Command
+	for i := 0; i < 5; i++ {
+		sources = append(sources, chunked(strings.Repeat(fmt.Sprintf("source-%d-line\n", i), 500), 3))
+	}
+	sources = append(sources, chunked("no newline", 2))
+
+	var output strings.Builder
+	err := yup.Interleave(sources...).Execute(context.Background(), strings.NewReader(""), &output, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	counts := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n") {
+		counts[line]++
+	}
+	for i := 0; i < 5; i++ {
+		if got := counts[fmt.Sprintf("source-%d-line", i)]; got != 500 {
+			t.Errorf("Source %d: expected 500 whole lines, got %d", i, got)
+		}
+	}
+	if counts["no newline"] != 1 || len(counts) != 6 {
+		t.Errorf("Found torn lines: %v", counts)
+	}
+}
@@ -0,0 +1,264 @@
+package opt
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrHelp is returned by Argv and ParseArgv when the arguments ask for
+// --help
+var ErrHelp = errors.New("help requested")
+
+// UsageError reports command-line arguments that do not fit a command's
+// flags. Its message follows getopt as used by coreutils.
+type UsageError struct {
+	Command string
+	Msg     string
+}
+
+func (e *UsageError) Error() string {
+	return e.Command + ": " + e.Msg
+}
+
+// Hint is the line coreutils prints after a usage error
+func (e *UsageError) Hint() string {
+	return fmt.Sprintf("Try '%s --help' for more information.", e.Command)
+}
+
+// ParseArgv parses GNU-style command-line arguments for the command name
+// into the flags F and the remaining positional arguments
+func ParseArgv[F any](name string, argv []string) (Inputs[string, F], error) {
+	parameters, err := Argv[F](name, argv)
+	if err != nil {
+		return Inputs[string, F]{}, err
+	}
+	return Args[string, F](parameters...), nil
+}
+
+// Argv parses GNU-style command-line arguments into the parameters a
+// command constructor takes: positional arguments as strings and options as
+// switches of F, in order. Options are described by FlagsOf[F]; a field
+// whose type is itself a Switch[F] is configured through it, others are set
+// directly. It supports clustered short options (-in), attached and
+// separate option arguments (-m5, -m 5, --max-count=5, --max-count 5),
+// unambiguous abbreviations of long options, options after positional
+// arguments and -- to end options. Slice fields collect repeated options.
+func Argv[F any](name string, argv []string) ([]any, error) {
+	return ArgvWith[F](name, FlagsOf[F](), argv)
+}
+
+// ArgvWith is Argv with options described by flags rather than derived
+// from the struct tags of F, e.g. to add short names to a foreign type.
+// Each flag's Index must name a field of F.
+func ArgvWith[F any](name string, flags []Flag, argv []string) ([]any, error) {
+	usage := func(format string, args ...any) error {
+		return &UsageError{Command: name, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	var parameters []any
+	repeated := map[int]int{} // Field index to the position of its switch
+
+	set := func(flag Flag, option, arg string) error {
+		value, err := parseValue(flag, arg, repeated, parameters)
+		if err != nil {
+			return usage("invalid argument '%s' for '%s'", arg, option)
+		}
+		sw := switchFor[F](flag, value)
+		if pos, ok := repeated[flag.Index]; ok {
+			parameters[pos] = sw
+			return nil
+		}
+		if flag.Type.Kind() == reflect.Slice {
+			repeated[flag.Index] = len(parameters)
+		}
+		parameters = append(parameters, sw)
+		return nil
+	}
+
+	for i := 0; i < len(argv); i++ {
+		arg := argv[i]
+		switch {
+		case arg == "--":
+			for _, rest := range argv[i+1:] {
+				parameters = append(parameters, rest)
+			}
+			return parameters, nil
+
+		case arg == "--help":
+			return nil, ErrHelp
+
+		case strings.HasPrefix(arg, "--"):
+			option, value, hasValue := strings.Cut(arg[2:], "=")
+			flag, err := lookupLong(flags, option, usage)
+			if err != nil {
+				return nil, err
+			}
+			long := "--" + flag.Long
+			switch {
+			case flag.IsBool() && hasValue:
+				return nil, usage("option '%s' doesn't allow an argument", long)
+			case !flag.IsBool() && !hasValue:
+				if i+1 == len(argv) {
+					return nil, usage("option '%s' requires an argument", long)
+				}
+				i++
+				value = argv[i]
+			}
+			if err := set(flag, long, value); err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			for k := 1; k < len(arg); k++ {
+				short := arg[k : k+1]
+				flag, ok := lookupShort(flags, short)
+				if !ok {
+					return nil, usage("invalid option -- '%s'", short)
+				}
+				value := ""
+				if !flag.IsBool() {
+					switch {
+					case k+1 < len(arg):
+						value = arg[k+1:]
+					case i+1 < len(argv):
+						i++
+						value = argv[i]
+					default:
+						return nil, usage("option requires an argument -- '%s'", short)
+					}
+					k = len(arg)
+				}
+				if err := set(flag, "-"+short, value); err != nil {
+					return nil, err
+				}
+			}
+
+		default:
+			parameters = append(parameters, arg)
+		}
+	}
+	return parameters, nil
+}
+
+// lookupLong finds a long option by name or unambiguous prefix
+func lookupLong(flags []Flag, name string, usage func(string, ...any) error) (Flag, error) {
+	var matches []Flag
+	for _, flag := range flags {
+		if flag.Long == name {
+			return flag, nil
+		}
+		if strings.HasPrefix(flag.Long, name) {
+			matches = append(matches, flag)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Flag{}, usage("unrecognized option '--%s'", name)
+	case 1:
+		return matches[0], nil
+	}
+	possibilities := make([]string, len(matches))
+	for i, flag := range matches {
+		possibilities[i] = "'--" + flag.Long + "'"
+	}
+	return Flag{}, usage("option '--%s' is ambiguous; possibilities: %s", name, strings.Join(possibilities, " "))
+}
+
+func lookupShort(flags []Flag, name string) (Flag, bool) {
+	for _, flag := range flags {
+		if flag.Short == name {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
+
+// parseValue converts an option argument to the flag's type. Repeated
+// slice options extend the value already recorded in parameters.
+func parseValue(flag Flag, arg string, repeated map[int]int, parameters []any) (reflect.Value, error) {
+	t := flag.Type
+	if t.Kind() != reflect.Slice {
+		return parseScalar(t, arg)
+	}
+
+	elem, err := parseScalar(t.Elem(), arg)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	list := reflect.MakeSlice(t, 0, 1)
+	if pos, ok := repeated[flag.Index]; ok {
+		list = switchValue(parameters[pos])
+	}
+	return reflect.Append(list, elem), nil
+}
+
+// parseScalar converts a single option argument to type t
+func parseScalar(t reflect.Type, arg string) (reflect.Value, error) {
+	value := reflect.New(t).Elem()
+	if t.Kind() == reflect.Bool {
+		value.SetBool(true)
+		return value, nil
+	}
+	if u, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return value, u.UnmarshalText([]byte(arg))
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		value.SetString(arg)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == reflect.TypeFor[time.Duration]() {
+			d, err := time.ParseDuration(arg)
+			value.SetInt(int64(d))
+			return value, err
+		}
+		n, err := strconv.ParseInt(arg, 10, t.Bits())
+		value.SetInt(n)
+		return value, err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(arg, 10, t.Bits())
+		value.SetUint(n)
+		return value, err
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(arg, t.Bits())
+		value.SetFloat(n)
+		return value, err
+	default:
+		return value, fmt.Errorf("unsupported flag type %s", t)
+	}
+	return value, nil
+}
+
+// switchFor wraps a parsed value as a switch of F
+func switchFor[F any](flag Flag, value reflect.Value) any {
+	if sw, ok := value.Interface().(Switch[F]); ok {
+		return sw
+	}
+	return fieldSwitch[F]{index: flag.Index, value: value}
+}
+
+// switchValue recovers the value held by a switch made by switchFor
+func switchValue(sw any) reflect.Value {
+	if fs, ok := sw.(interface{ fieldValue() reflect.Value }); ok {
+		return fs.fieldValue()
+	}
+	return reflect.ValueOf(sw)
+}
+
+// fieldSwitch sets one field of F directly, for field types that do not
+// configure themselves
+type fieldSwitch[F any] struct {
+	index int
+	value reflect.Value
+}
+
+func (s fieldSwitch[F]) Configure(flags *F) {
+	reflect.ValueOf(flags).Elem().Field(s.index).Set(s.value)
+}
+
+func (s fieldSwitch[F]) fieldValue() reflect.Value { return s.value }
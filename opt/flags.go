@@ -0,0 +1,112 @@
+package opt
+
+import (
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Flag describes one field of a command's Flags struct as a command-line
+// option. It is derived from the field's name, type and struct tags:
+//
+//	IgnoreCase IgnoreCaseFlag `flag:"i,ignore-case" usage:"ignore case distinctions"`
+//	MaxCount   MaxCount       `flag:"m" value:"NUM" usage:"stop after NUM matches"`
+//
+// Names in the flag tag of one character are short options, longer ones the
+// long option; without a long name the field name is used in kebab case.
+// A flag tag of "-" hides the field from the command line.
+type Flag struct {
+	Field string       // Name of the struct field
+	Index int          // Index of the struct field
+	Type  reflect.Type // Type of the struct field, whose values are the switches
+	Short string       // Short option without the dash, if any
+	Long  string       // Long option without the dashes
+	Value string       // Placeholder for the option's argument, empty for booleans
+	Usage string       // One-line description
+}
+
+// IsBool reports whether the flag is a switch that takes no argument
+func (f Flag) IsBool() bool {
+	return f.Type.Kind() == reflect.Bool
+}
+
+// FlagsOf describes the options of the flags struct F
+func FlagsOf[F any]() []Flag {
+	return FlagsFor(reflect.TypeFor[F]())
+}
+
+// FlagsFor describes the options of the flags struct type t; it returns nil
+// for anything other than a struct or a pointer to one
+func FlagsFor(t reflect.Type) []Flag {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var flags []Flag
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("flag")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+
+		flag := Flag{Field: field.Name, Index: i, Type: field.Type, Usage: field.Tag.Get("usage")}
+		for _, name := range strings.Split(tag, ",") {
+			switch name = strings.TrimLeft(strings.TrimSpace(name), "-"); {
+			case name == "":
+			case len(name) == 1:
+				flag.Short = name
+			default:
+				flag.Long = name
+			}
+		}
+		if flag.Long == "" {
+			flag.Long = KebabCase(field.Name)
+		}
+		if !flag.IsBool() {
+			flag.Value = field.Tag.Get("value")
+			if flag.Value == "" {
+				flag.Value = valueName(field.Type)
+			}
+		}
+		flags = append(flags, flag)
+	}
+	return flags
+}
+
+// valueName picks a placeholder for an option argument of type t
+func valueName(t reflect.Type) string {
+	if t == reflect.TypeFor[time.Duration]() {
+		return "DURATION"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "NUM"
+	case reflect.Float32, reflect.Float64:
+		return "NUMBER"
+	}
+	return "STRING"
+}
+
+// KebabCase converts a Go identifier such as IgnoreCase to ignore-case
+func KebabCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word unless inside an acronym (e.g. "NoEOL")
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -14,6 +14,12 @@ type Switch[T any] interface {
 	Configure(*T)
 }
 
+// Positional is implemented by values that stand in for a positional
+// argument of type T, such as a command substituted for a filename
+type Positional[T any] interface {
+	Positional() T
+}
+
 func configure[T any](opts ...Switch[T]) T {
 	def := new(T)
 	for _, opt := range opts {
@@ -36,6 +42,8 @@ func Args[T any, O any](parameters ...any) Inputs[T, O] {
 			inputs = append(inputs, v)
 		case Switch[O]:
 			options = append(options, v)
+		case Positional[T]:
+			inputs = append(inputs, v.Positional())
 		default:
 			slog.Warn("Unknown argument type", "arg", v, "type", fmt.Sprintf("%T/%T", arg, v))
 		}
@@ -0,0 +1,951 @@
+package yup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Constructor builds a command from its arguments, in the form every yupsh
+// command constructor takes. The parser passes each argument word as a
+// string.
+type Constructor func(parameters ...any) Command
+
+// Resolver looks up the constructor for a command name
+type Resolver interface {
+	Resolve(name string) (Constructor, bool)
+}
+
+// Commands is the simplest Resolver: a table from names to constructors
+type Commands map[string]Constructor
+
+// Resolve returns the constructor registered under name
+func (c Commands) Resolve(name string) (Constructor, bool) {
+	ctor, ok := c[name]
+	return ctor, ok
+}
+
+// SyntaxError reports where and why a command line could not be parsed
+type SyntaxError struct {
+	Offset int // Byte offset into the source
+	Msg    string
+
+	incomplete bool // The source ended early, so more input could fix it
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at column %d: %s", e.Offset+1, e.Msg)
+}
+
+// Parse builds a command from POSIX shell syntax, resolving command names
+// through registry. It understands quoting and backslash escapes, $NAME and
+// ${NAME} expansion, NAME=value assignments, pipes (| and |&), lists (&&,
+// || and ;), brace groups, redirections (<, >, >>, 2>, 2>>, 2>&1, >&2, &>)
+// and process substitution <(...). Syntax errors carry status 2 and unknown
+// commands status 127.
+//
+// Assignments before a command export variables to it alone. On their own
+// they set shell variables, which last in the Shell running them; anywhere
+// else they fail.
+//
+// Variables and substitutions are expanded each time the command runs, in
+// the Env of the context it runs with, so a parsed command can be run again
+// with other values. A command whose name is itself an expansion is
+// resolved then too, reporting an unknown name on stderr with status 127.
+func Parse(ctx context.Context, src string, registry Resolver) (Command, error) {
+	p := &parser{src: src, registry: registry}
+	cmd, err := p.parseList(endOfInput)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.unexpected()
+	}
+	return cmd, nil
+}
+
+// listEnd says what terminates the list being parsed
+type listEnd int
+
+const (
+	endOfInput listEnd = iota
+	endOfGroup         // }
+	endOfSub           // )
+)
+
+type parser struct {
+	src      string
+	pos      int
+	registry Resolver
+}
+
+// parseError wraps a syntax error with the shell's status for it
+func (p *parser) parseError(offset int, format string, args ...any) error {
+	return ExitWithError(StatusUsage, &SyntaxError{Offset: offset, Msg: fmt.Sprintf(format, args...)})
+}
+
+// incompleteError is parseError for input that ends too early
+func (p *parser) incompleteError(offset int, msg string) error {
+	return ExitWithError(StatusUsage, &SyntaxError{Offset: offset, Msg: msg, incomplete: true})
+}
+
+func (p *parser) unexpected() error {
+	if p.pos >= len(p.src) {
+		return p.incompleteError(p.pos, "unexpected end of input")
+	}
+	return p.parseError(p.pos, "unexpected %q", p.src[p.pos:p.pos+1])
+}
+
+func (p *parser) peek(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+// skipBlanks skips spaces, tabs, line continuations and comments
+func (p *parser) skipBlanks() {
+	for !p.eof() {
+		switch {
+		case p.src[p.pos] == ' ' || p.src[p.pos] == '\t':
+			p.pos++
+		case p.peek("\\\n"):
+			p.pos += 2
+		case p.src[p.pos] == '#':
+			for !p.eof() && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// skipLines skips blanks and newlines
+func (p *parser) skipLines() {
+	for {
+		p.skipBlanks()
+		if p.eof() || p.src[p.pos] != '\n' {
+			return
+		}
+		p.pos++
+	}
+}
+
+// atListEnd reports whether the list being parsed ends here
+func (p *parser) atListEnd(end listEnd) bool {
+	if p.eof() {
+		return true
+	}
+	switch end {
+	case endOfGroup:
+		return p.src[p.pos] == '}' && (p.pos+1 == len(p.src) || isDelimiter(p.src[p.pos+1]))
+	case endOfSub:
+		return p.src[p.pos] == ')'
+	}
+	return false
+}
+
+// parseList parses commands separated by ; or newlines
+func (p *parser) parseList(end listEnd) (Command, error) {
+	var items []Command
+	for {
+		p.skipLines()
+		if p.atListEnd(end) {
+			break
+		}
+		cmd, err := p.parseAndOr(end)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, cmd)
+
+		p.skipBlanks()
+		if p.eof() || (p.src[p.pos] != ';' && p.src[p.pos] != '\n') {
+			break
+		}
+		if p.peek(";;") {
+			return nil, p.unexpected()
+		}
+		p.pos++
+	}
+
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return Seq(items...), nil
+}
+
+// parseAndOr parses pipelines joined by && and ||, which associate left
+func (p *parser) parseAndOr(end listEnd) (Command, error) {
+	cmd, err := p.parsePipeline(end)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipBlanks()
+		var op listOp
+		switch {
+		case p.peek("&&"):
+			op = opAnd
+		case p.peek("||"):
+			op = opOr
+		default:
+			return cmd, nil
+		}
+		p.pos += 2
+		p.skipLines()
+
+		next, err := p.parsePipeline(end)
+		if err != nil {
+			return nil, err
+		}
+		if list, ok := cmd.(*commandList); ok && list.op == op {
+			cmd = &commandList{op: op, commands: append(list.commands[:len(list.commands):len(list.commands)], next)}
+		} else {
+			cmd = &commandList{op: op, commands: []Command{cmd, next}}
+		}
+	}
+}
+
+// parsePipeline parses commands joined by | and |&
+func (p *parser) parsePipeline(end listEnd) (Command, error) {
+	var stages []Command
+	for {
+		cmd, err := p.parseCommand(end)
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipBlanks()
+		switch {
+		case p.peek("|&"):
+			cmd = MergeStderr(cmd)
+			p.pos += 2
+		case p.peek("|") && !p.peek("||"):
+			p.pos++
+		default:
+			stages = append(stages, cmd)
+			if len(stages) == 1 {
+				return stages[0], nil
+			}
+			return Pipe(stages...), nil
+		}
+		stages = append(stages, cmd)
+		p.skipLines()
+	}
+}
+
+// parseCommand parses a brace group or a simple command, with redirections
+func (p *parser) parseCommand(end listEnd) (Command, error) {
+	p.skipBlanks()
+	if p.atListEnd(end) || p.eof() {
+		return nil, p.unexpected()
+	}
+
+	if p.src[p.pos] == '{' && p.pos+1 < len(p.src) && isDelimiter(p.src[p.pos+1]) {
+		return p.parseGroup()
+	}
+
+	var assigns []assignWord
+	var words []word
+	var redirs []redirWord
+	for {
+		p.skipBlanks()
+		if p.eof() || p.src[p.pos] == '\n' || isOperatorStart(p.src[p.pos]) && !p.peek("<(") && !p.atRedirection() {
+			break
+		}
+
+		if p.atRedirection() {
+			r, err := p.parseRedirection()
+			if err != nil {
+				return nil, err
+			}
+			redirs = append(redirs, r...)
+			continue
+		}
+
+		if name, ok := p.assignmentName(); ok && len(words) == 0 {
+			p.pos += len(name) + 1
+			value, err := p.parseWord()
+			if err != nil {
+				return nil, err
+			}
+			assigns = append(assigns, assignWord{name: name, value: value})
+			continue
+		}
+
+		start := p.pos
+		w, err := p.parseWord()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos == start {
+			return nil, p.unexpected()
+		}
+		words = append(words, w)
+	}
+
+	switch {
+	case len(words) > 0:
+		return p.command(assigns, words, nil, redirs)
+	case len(redirs) > 0:
+		return nil, p.parseError(p.pos, "redirection without a command")
+	case len(assigns) > 0:
+		return &assignment{assigns: assigns}, nil
+	}
+	return nil, p.unexpected()
+}
+
+// assignmentName returns NAME when the input continues with NAME=
+func (p *parser) assignmentName() (string, bool) {
+	end := p.pos
+	for end < len(p.src) && isNameChar(p.src[end], end == p.pos) {
+		end++
+	}
+	if end == p.pos || end == len(p.src) || p.src[end] != '=' {
+		return "", false
+	}
+	return p.src[p.pos:end], true
+}
+
+// parseGroup parses { list; } and any redirections after it
+func (p *parser) parseGroup() (Command, error) {
+	open := p.pos
+	p.pos++
+	cmd, err := p.parseList(endOfGroup)
+	if err != nil {
+		return nil, err
+	}
+	if p.eof() {
+		return nil, p.incompleteError(open, "unterminated {")
+	}
+	p.pos++
+
+	var redirs []redirWord
+	for {
+		p.skipBlanks()
+		if !p.atRedirection() {
+			break
+		}
+		r, err := p.parseRedirection()
+		if err != nil {
+			return nil, err
+		}
+		redirs = append(redirs, r...)
+	}
+	return p.command(nil, nil, cmd, redirs)
+}
+
+// command builds a simple command from its words, or with no words the
+// group, with its assignments and redirections. A command name written out
+// literally is resolved now; anything to expand waits until the command
+// runs.
+func (p *parser) command(assigns []assignWord, words []word, group Command, redirs []redirWord) (Command, error) {
+	var ctor Constructor
+	if len(words) > 0 {
+		if name, ok := words[0].text(); ok {
+			var found bool
+			if ctor, found = p.registry.Resolve(name); !found {
+				return nil, ExitWithError(StatusNotFound, fmt.Errorf("%s: command not found", name))
+			}
+		}
+	}
+
+	literal := len(assigns) == 0
+	for _, w := range words {
+		if _, ok := w.text(); !ok {
+			literal = false
+		}
+	}
+	for _, r := range redirs {
+		if _, ok := r.target.text(); !ok {
+			literal = false
+		}
+	}
+	if !literal {
+		return &deferredCommand{registry: p.registry, ctor: ctor, assigns: assigns, words: words, group: group, redirs: redirs}, nil
+	}
+
+	cmd := group
+	if cmd == nil {
+		args := make([]any, len(words)-1)
+		for i, w := range words[1:] {
+			args[i], _ = w.text()
+		}
+		cmd = ctor(args...)
+	}
+	var redirections []Redirection
+	for _, r := range redirs {
+		file, _ := r.target.text()
+		redirections = append(redirections, r.redirections(file)...)
+	}
+	if len(redirections) > 0 {
+		cmd = Redirect(cmd, redirections...)
+	}
+	return cmd, nil
+}
+
+// atRedirection reports whether a redirection operator starts here,
+// including one with a leading descriptor number such as 2>
+func (p *parser) atRedirection() bool {
+	rest := p.src[p.pos:]
+	if len(rest) > 1 && rest[0] >= '0' && rest[0] <= '9' && (rest[1] == '<' || rest[1] == '>') {
+		rest = rest[1:]
+	}
+	switch {
+	case strings.HasPrefix(rest, "<("):
+		return false
+	case strings.HasPrefix(rest, "&>"):
+		return true
+	}
+	return len(rest) > 0 && (rest[0] == '<' || rest[0] == '>')
+}
+
+// parseRedirection parses one redirection
+func (p *parser) parseRedirection() ([]redirWord, error) {
+	start := p.pos
+	fd := -1
+	if c := p.src[p.pos]; c >= '0' && c <= '9' {
+		fd = int(c - '0')
+		p.pos++
+	}
+
+	var op string
+	for _, candidate := range []string{"&>>", "&>", ">>", ">&", ">", "<&", "<"} {
+		if p.peek(candidate) {
+			op = candidate
+			break
+		}
+	}
+	p.pos += len(op)
+
+	if fd == -1 {
+		fd = 1
+		if op == "<" || op == "<&" {
+			fd = 0
+		}
+	}
+	if fd > 2 || (fd == 0) != (op == "<" || op == "<&") || (fd != 1 && op[0] == '&') {
+		return nil, p.parseError(start, "unsupported redirection %q", p.src[start:p.pos])
+	}
+
+	if op == ">&" || op == "<&" {
+		target := p.src[p.pos:min(p.pos+1, len(p.src))]
+		p.pos += len(target)
+		switch {
+		case fd == 2 && target == "1":
+			return []redirWord{{op: "2>&1"}}, nil
+		case fd == 1 && target == "2":
+			return []redirWord{{op: ">&2"}}, nil
+		case fd == 1 && target == "1", fd == 2 && target == "2":
+			return nil, nil
+		}
+		return nil, p.parseError(start, "unsupported redirection %q", p.src[start:p.pos])
+	}
+
+	p.skipBlanks()
+	wordStart := p.pos
+	target, err := p.parseWord()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos == wordStart {
+		return nil, p.unexpected()
+	}
+	if fd == 2 {
+		op = "2" + op
+	}
+	return []redirWord{{op: op, target: target}}, nil
+}
+
+// parseWord parses one word, applying quote removal. Parameter expansion
+// and process substitution are left for expand, when the command runs.
+func (p *parser) parseWord() (word, error) {
+	var w word
+	for !p.eof() {
+		c := p.src[p.pos]
+		switch {
+		case p.peek("<("):
+			cmd, err := p.parseSubstitution()
+			if err != nil {
+				return nil, err
+			}
+			w = append(w, wordPart{kind: substitutionPart, cmd: cmd})
+		case isDelimiter(c):
+			return w, nil
+		case c == '\\':
+			p.pos++
+			if p.eof() {
+				w.literal("\\")
+			} else if p.src[p.pos] == '\n' {
+				p.pos++
+			} else {
+				w.literal(p.src[p.pos : p.pos+1])
+				p.pos++
+			}
+		case c == '\'':
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return nil, p.incompleteError(p.pos, "unterminated single quote")
+			}
+			w.literal(p.src[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+		case c == '"':
+			if err := p.parseDoubleQuoted(&w); err != nil {
+				return nil, err
+			}
+		case c == '$':
+			name, ok, err := p.parseExpansion()
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				w = append(w, wordPart{kind: variablePart, text: name})
+			} else {
+				w.literal("$")
+			}
+		case c == '`':
+			return nil, p.parseError(p.pos, "command substitution is not supported")
+		default:
+			start := p.pos
+			for !p.eof() && !isDelimiter(p.src[p.pos]) && !strings.ContainsRune("\\'\"$`", rune(p.src[p.pos])) && !p.peek("<(") {
+				p.pos++
+			}
+			w.literal(p.src[start:p.pos])
+		}
+	}
+	return w, nil
+}
+
+// parseDoubleQuoted parses "..." where only \ and $ keep their meaning
+func (p *parser) parseDoubleQuoted(w *word) error {
+	open := p.pos
+	p.pos++
+	w.literal("")
+	for {
+		if p.eof() {
+			return p.incompleteError(open, "unterminated double quote")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return nil
+		case c == '\\' && p.pos+1 < len(p.src) && strings.ContainsRune("$`\"\\\n", rune(p.src[p.pos+1])):
+			if p.src[p.pos+1] != '\n' {
+				w.literal(p.src[p.pos+1 : p.pos+2])
+			}
+			p.pos += 2
+		case c == '$':
+			name, ok, err := p.parseExpansion()
+			if err != nil {
+				return err
+			}
+			if ok {
+				*w = append(*w, wordPart{kind: quotedPart, text: name})
+			} else {
+				w.literal("$")
+			}
+		case c == '`':
+			return p.parseError(p.pos, "command substitution is not supported")
+		default:
+			w.literal(p.src[p.pos : p.pos+1])
+			p.pos++
+		}
+	}
+}
+
+// parseExpansion parses $NAME or ${NAME} and returns the name; ok is false
+// for a lone $
+func (p *parser) parseExpansion() (string, bool, error) {
+	start := p.pos
+	p.pos++
+	if p.peek("(") {
+		return "", false, p.parseError(start, "command substitution is not supported")
+	}
+
+	braced := p.peek("{")
+	if braced {
+		p.pos++
+	}
+	nameStart := p.pos
+	for !p.eof() && isNameChar(p.src[p.pos], p.pos == nameStart) {
+		p.pos++
+	}
+	name := p.src[nameStart:p.pos]
+
+	if braced {
+		if name == "" || !p.peek("}") {
+			return "", false, p.parseError(start, "bad substitution")
+		}
+		p.pos++
+	} else if name == "" {
+		p.pos = start + 1
+		return "", false, nil
+	}
+	return name, true, nil
+}
+
+// parseSubstitution parses <(list) and returns the list
+func (p *parser) parseSubstitution() (Command, error) {
+	open := p.pos
+	p.pos += 2
+	cmd, err := p.parseList(endOfSub)
+	if err != nil {
+		return nil, err
+	}
+	if p.eof() {
+		return nil, p.incompleteError(open, "unterminated <(")
+	}
+	p.pos++
+	return cmd, nil
+}
+
+// partKind says how a part of a word expands
+type partKind int
+
+const (
+	literalPart      partKind = iota // Text as it stands
+	variablePart                     // $NAME, split into fields at blanks
+	quotedPart                       // "$NAME", kept in one field
+	substitutionPart                 // <(list), replaced by its name
+)
+
+// wordPart is one piece of a parsed word
+type wordPart struct {
+	kind partKind
+	text string  // The literal text or variable name
+	cmd  Command // The list of a substitution
+}
+
+// word is a word as parsed, expanded each time its command runs
+type word []wordPart
+
+// literal appends text that is not subject to expansion
+func (w *word) literal(s string) {
+	if n := len(*w); n > 0 && (*w)[n-1].kind == literalPart {
+		(*w)[n-1].text += s
+		return
+	}
+	*w = append(*w, wordPart{kind: literalPart, text: s})
+}
+
+// text returns the text of a word with nothing to expand
+func (w word) text() (string, bool) {
+	var b strings.Builder
+	for _, part := range w {
+		if part.kind != literalPart {
+			return "", false
+		}
+		b.WriteString(part.text)
+	}
+	return b.String(), true
+}
+
+// describe renders the word in shell syntax, with its expansions as written
+func (w word) describe() string {
+	var b strings.Builder
+	for _, part := range w {
+		switch part.kind {
+		case literalPart:
+			if part.text != "" || len(w) == 1 {
+				b.WriteString(QuoteWord(part.text))
+			}
+		case variablePart:
+			b.WriteString("${" + part.text + "}")
+		case quotedPart:
+			b.WriteString(`"${` + part.text + `}"`)
+		case substitutionPart:
+			b.WriteString("<(" + Describe(part.cmd) + ")")
+		}
+	}
+	return b.String()
+}
+
+// redirWord is a parsed redirection, its target word not yet expanded
+type redirWord struct {
+	op     string // <, >, >>, 2>, 2>>, &>, &>>, or 2>&1 and >&2 without a target
+	target word
+}
+
+// redirections returns the Redirections for the target file
+func (r redirWord) redirections(file string) []Redirection {
+	switch r.op {
+	case "2>&1":
+		return []Redirection{StderrToStdout}
+	case ">&2":
+		return []Redirection{StdoutToStderr}
+	case "<":
+		return []Redirection{StdinFrom(file)}
+	case "&>":
+		return []Redirection{StdoutTo(file), StderrToStdout}
+	case "&>>":
+		return []Redirection{StdoutAppend(file), StderrToStdout}
+	case "2>>":
+		return []Redirection{StderrAppend(file)}
+	case "2>":
+		return []Redirection{StderrTo(file)}
+	case ">>":
+		return []Redirection{StdoutAppend(file)}
+	}
+	return []Redirection{StdoutTo(file)}
+}
+
+// assignWord is a parsed NAME=value, its value not yet expanded
+type assignWord struct {
+	name  string
+	value word
+}
+
+func (a assignWord) describe() string {
+	return a.name + "=" + a.value.describe()
+}
+
+// expansion expands words in the Env of the context a command runs with,
+// naming the substitutions it meets in turn
+type expansion struct {
+	ctx  context.Context
+	subs map[string]*Substitution
+}
+
+// fields returns the fields w expands to: unquoted expansions are split on
+// blanks, so a word can yield zero or several
+func (x *expansion) fields(w word) []string {
+	var f fieldBuilder
+	for _, part := range w {
+		switch part.kind {
+		case literalPart:
+			f.literal(part.text)
+		case variablePart:
+			value, _ := LookupVar(x.ctx, part.text)
+			f.split(value)
+		case quotedPart:
+			value, _ := LookupVar(x.ctx, part.text)
+			f.literal(value)
+		case substitutionPart:
+			if x.subs == nil {
+				x.subs = map[string]*Substitution{}
+			}
+			name := substitutionName(len(x.subs))
+			x.subs[name] = Sub(part.cmd)
+			f.literal(name)
+		}
+	}
+	return f.done()
+}
+
+// value returns the text w expands to as the value of an assignment, which
+// is not split into fields
+func (x *expansion) value(w word) string {
+	quoted := make(word, len(w))
+	for i, part := range w {
+		if part.kind == variablePart {
+			part.kind = quotedPart
+		}
+		quoted[i] = part
+	}
+	return strings.Join(x.fields(quoted), "")
+}
+
+// assign returns a copy of env, or of the process environment if nil, with
+// the assignments made in order, so that each sees those before it.
+// Variables already exported stay so, and export exports the others too.
+func assign(ctx context.Context, env *Env, assigns []assignWord, export bool) *Env {
+	if env == nil {
+		env = ProcessEnv()
+	} else {
+		env = env.Clone()
+	}
+	x := &expansion{ctx: WithEnv(ctx, env)}
+	for _, a := range assigns {
+		value := x.value(a.value)
+		if _, exported := env.Vars[a.name]; exported || export {
+			delete(env.Locals, a.name)
+			env.Vars[a.name] = value
+		} else {
+			env.Locals[a.name] = value
+		}
+	}
+	return env
+}
+
+// assignment sets shell variables, like NAME=value with no command. The
+// variables last in the shell running it; outside a Shell it fails.
+type assignment struct {
+	assigns []assignWord
+}
+
+func (a *assignment) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	live, _ := ctx.Value(envKey{}).(liveEnv)
+	if live == nil || live.env() == nil {
+		err := errors.New("no shell environment")
+		ErrorF(stderr, a.assigns[0].name, "", err)
+		return ExitWithError(StatusFailure, err)
+	}
+	live.setEnv(assign(ctx, live.env(), a.assigns, false))
+	return nil
+}
+
+func (a *assignment) Describe() string {
+	words := make([]string, len(a.assigns))
+	for i, assign := range a.assigns {
+		words[i] = assign.describe()
+	}
+	return strings.Join(words, " ")
+}
+
+// deferredCommand is a simple command or group with words still to expand.
+// They are expanded each time it runs, so variables take their values and
+// substitutions their names from that run.
+type deferredCommand struct {
+	registry Resolver
+	ctor     Constructor  // Resolved when parsing if the name is literal
+	assigns  []assignWord // Variables exported to the command alone
+	words    []word       // The command name and arguments; none for a group
+	group    Command
+	redirs   []redirWord
+}
+
+func (d *deferredCommand) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	ctx = startEnv(ctx)
+	x := &expansion{ctx: ctx}
+	cmd := d.group
+	if cmd == nil {
+		var fields []string
+		for _, w := range d.words {
+			fields = append(fields, x.fields(w)...)
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		ctor := d.ctor
+		if ctor == nil {
+			var ok bool
+			if ctor, ok = d.registry.Resolve(fields[0]); !ok {
+				ErrorF(stderr, fields[0], "", errors.New("command not found"))
+				return ExitWithError(StatusNotFound, fmt.Errorf("%s: command not found", fields[0]))
+			}
+		}
+		args := make([]any, len(fields)-1)
+		for i, field := range fields[1:] {
+			args[i] = field
+		}
+		cmd = ctor(args...)
+	}
+
+	var redirections []Redirection
+	for _, r := range d.redirs {
+		var file string
+		if r.target != nil {
+			fields := x.fields(r.target)
+			if len(fields) != 1 {
+				err := errors.New("ambiguous redirect")
+				ErrorF(stderr, commandName(cmd), r.target.describe(), err)
+				return ExitWithError(StatusFailure, err)
+			}
+			file = fields[0]
+		}
+		redirections = append(redirections, r.redirections(file)...)
+	}
+	if len(redirections) > 0 {
+		cmd = Redirect(cmd, redirections...)
+	}
+	if len(d.assigns) > 0 {
+		ctx = WithEnv(ctx, assign(ctx, EnvFrom(ctx), d.assigns, true))
+	}
+	return substitute(cmd, x.subs).Execute(ctx, stdin, stdout, stderr)
+}
+
+// Describe renders the command as written, its expansions unexpanded
+func (d *deferredCommand) Describe() string {
+	var words []string
+	for _, a := range d.assigns {
+		words = append(words, a.describe())
+	}
+	if d.group != nil {
+		words = append(words, describeSimple(d.group))
+	}
+	for _, w := range d.words {
+		words = append(words, w.describe())
+	}
+	for _, r := range d.redirs {
+		words = append(words, r.op+r.target.describe())
+	}
+	return strings.Join(words, " ")
+}
+
+// fieldBuilder accumulates the fields a word expands to
+type fieldBuilder struct {
+	fields []string
+	cur    strings.Builder
+	open   bool // whether cur holds a field, possibly empty
+}
+
+// literal appends text that is not subject to field splitting
+func (w *fieldBuilder) literal(s string) {
+	w.cur.WriteString(s)
+	w.open = true
+}
+
+// split appends an unquoted expansion, breaking fields at blanks
+func (w *fieldBuilder) split(s string) {
+	for i, part := range strings.FieldsFunc(s, isBlank) {
+		if i > 0 || (len(s) > 0 && isBlank(rune(s[0]))) {
+			w.flush()
+		}
+		w.literal(part)
+	}
+	if len(s) > 0 && isBlank(rune(s[len(s)-1])) {
+		w.flush()
+	}
+}
+
+func (w *fieldBuilder) flush() {
+	if w.open {
+		w.fields = append(w.fields, w.cur.String())
+		w.cur.Reset()
+		w.open = false
+	}
+}
+
+func (w *fieldBuilder) done() []string {
+	w.flush()
+	return w.fields
+}
+
+func isBlank(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n'
+}
+
+// isDelimiter reports whether c ends an unquoted word
+func isDelimiter(c byte) bool {
+	return isBlank(rune(c)) || isOperatorStart(c)
+}
+
+func isOperatorStart(c byte) bool {
+	return strings.IndexByte(";&|<>()", c) >= 0
+}
+
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
+
+// isVarName reports whether s is a valid variable name
+func isVarName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isNameChar(s[i], i == 0) {
+			return false
+		}
+	}
+	return s != ""
+}
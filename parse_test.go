@@ -0,0 +1,297 @@
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+	"github.com/yupsh/framework/opt"
+)
+
+// argv writes each of its arguments on a line of its own
+func argv(parameters ...any) yup.Command {
+	return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		for _, p := range parameters {
+			_, _ = fmt.Fprintln(stdout, p)
+		}
+		return nil
+	})
+}
+
+// catFiles copies its files, or stdin without any, to stdout
+func catFiles(parameters ...any) yup.Command {
+	files := make([]string, len(parameters))
+	for i, p := range parameters {
+		files[i] = p.(string)
+	}
+	return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		return yup.ProcessFilesWithContext(ctx, files, stdin, stdout, stderr, yup.FileProcessorOptions{CommandName: "cat"},
+			func(ctx context.Context, source yup.InputSource, output io.Writer) error {
+				_, err := io.Copy(output, source.Reader)
+				return err
+			})
+	})
+}
+
+// named describes itself as its name and arguments
+func named(name string) yup.Constructor {
+	return func(parameters ...any) yup.Command {
+		cmd := grepCommand{yup.StandardCommand[grepFlags]{Name: name}}
+		cmd.Positional = opt.Args[string, grepFlags](parameters...).Positional
+		return cmd
+	}
+}
+
+func TestParseStructure(t *testing.T) {
+	registry := yup.Commands{"cat": named("cat"), "grep": named("grep"), "wc": named("wc"), "sort": named("sort")}
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"cat a.txt | grep foo | wc", "cat a.txt | grep foo | wc"},
+		{"cat a.txt|grep foo", "cat a.txt | grep foo"},
+		{"cat a && grep b || wc", "cat a && grep b || wc"},
+		{"cat a || grep b && wc", "cat a || grep b && wc"},
+		{"cat a || { grep b && wc; }", "cat a || { grep b && wc; }"},
+		{"cat a; grep b\nwc\n", "cat a; grep b; wc"},
+		{"cat a && { grep b; wc; }", "cat a && { grep b; wc; }"},
+		{"{ cat a || grep b; } | wc", "{ cat a || grep b; } | wc"},
+		{"cat <in.txt >out.txt 2>>err.log", "cat <in.txt >out.txt 2>>err.log"},
+		{"cat a 2>&1 | wc", "cat a 2>&1 | wc"},
+		{"cat a |& wc", "cat a 2>&1 | wc"},
+		{"cat a &> both.log", "cat a >both.log 2>&1"},
+		{"grep x >&2", "grep x >&2"},
+		{"{ cat a; wc; } > out", "{ cat a; wc; } >out"},
+		{"cat 'it''s' \"a b\" c\\ d", "cat its 'a b' 'c d'"},
+		{"cat a # comment | wc", "cat a"},
+		{"cat a \\\n  b", "cat a b"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			cmd, err := yup.Parse(context.Background(), tt.src, registry)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := yup.Describe(cmd); got != tt.want {
+				t.Errorf("Parse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWords(t *testing.T) {
+	t.Setenv("YUP_WORDS", " one  two ")
+	t.Setenv("YUP_EMPTY", "")
+	registry := yup.Commands{"argv": argv}
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{`argv $YUP_WORDS`, []string{"one", "two"}},
+		{`argv "$YUP_WORDS"`, []string{" one  two "}},
+		{`argv x${YUP_WORDS}y`, []string{"x", "one", "two", "y"}},
+		{`argv $YUP_EMPTY $YUP_UNSET`, nil},
+		{`argv "$YUP_EMPTY" ''`, []string{"", ""}},
+		{`argv '$YUP_WORDS' \$YUP_WORDS`, []string{"$YUP_WORDS", "$YUP_WORDS"}},
+		{`argv "a \"b\" \\ \c"`, []string{`a "b" \ \c`}},
+		{`argv $ a$ "$"`, []string{"$", "a$", "$"}},
+		{`argv a}b {c`, []string{"a}b", "{c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			cmd, err := yup.Parse(context.Background(), tt.src, registry)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var output strings.Builder
+			if err := cmd.Execute(context.Background(), strings.NewReader(""), &output, io.Discard); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			var got []string
+			if output.Len() > 0 {
+				got = strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("arguments = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	registry := yup.Commands{"cat": catFiles}
+	tests := []struct {
+		src        string
+		wantStatus int
+		wantMsg    string
+	}{
+		{"nosuch a", yup.StatusNotFound, "nosuch: command not found"},
+		{"cat a | nosuch", yup.StatusNotFound, "nosuch: command not found"},
+		{"cat 'a", yup.StatusUsage, "column 5: unterminated single quote"},
+		{`cat "a`, yup.StatusUsage, "column 5: unterminated double quote"},
+		{"cat a |", yup.StatusUsage, "unexpected end of input"},
+		{"| cat", yup.StatusUsage, `column 1: unexpected "|"`},
+		{"cat a && && cat", yup.StatusUsage, `unexpected "&"`},
+		{"cat a )", yup.StatusUsage, `unexpected ")"`},
+		{"{ cat a", yup.StatusUsage, "unterminated {"},
+		{"cat <(cat a", yup.StatusUsage, "unterminated <("},
+		{"cat $(ls)", yup.StatusUsage, "command substitution is not supported"},
+		{"cat `ls`", yup.StatusUsage, "command substitution is not supported"},
+		{"cat ${}", yup.StatusUsage, "bad substitution"},
+		{"cat 3>x", yup.StatusUsage, "unsupported redirection"},
+		{"> out", yup.StatusUsage, "redirection without a command"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := yup.Parse(context.Background(), tt.src, registry)
+			if err == nil {
+				t.Fatal("Parse() error = nil")
+			}
+			if got := yup.ExitStatus(err); got != tt.wantStatus {
+				t.Errorf("ExitStatus() = %d, want %d", got, tt.wantStatus)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("Parse() error = %q, want it to mention %q", err, tt.wantMsg)
+			}
+			var syntaxErr *yup.SyntaxError
+			if isSyntax := errors.As(err, &syntaxErr); isSyntax != (tt.wantStatus == yup.StatusUsage) {
+				t.Errorf("errors.As(SyntaxError) = %v", isSyntax)
+			}
+		})
+	}
+}
+
+func TestParseExecute(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.txt")
+	if err := os.WriteFile(in, []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.txt")
+	registry := yup.Commands{"cat": catFiles, "argv": argv}
+
+	src := fmt.Sprintf("cat < %s | cat - <(argv world) > %s && argv done >> '%s'", in, out, out)
+	cmd, err := yup.Parse(context.Background(), src, registry)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if err := cmd.Execute(context.Background(), strings.NewReader(""), io.Discard, io.Discard); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello\nworld\ndone\n"; string(got) != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestParseExpandsWhenRun(t *testing.T) {
+	registry := yup.Commands{"argv": argv, "cat": catFiles}
+	cmd, err := yup.Parse(context.Background(), `argv "$GREETING" $NAMES <(argv sub)`, registry)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	described, err := yup.Parse(context.Background(), `cat "$GREETING"x $NAMES <(cat sub) > "$OUT"`, yup.Commands{"cat": named("cat")})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got, want := yup.Describe(described), `cat "${GREETING}"x ${NAMES} <(cat sub) >"${OUT}"`; got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+
+	// Each run expands in its own Env, with substitutions named afresh
+	for _, names := range []string{"a b", "c"} {
+		env := &yup.Env{Vars: map[string]string{"GREETING": "hello there", "NAMES": names}}
+		var output strings.Builder
+		if err := cmd.Execute(yup.WithEnv(context.Background(), env), strings.NewReader(""), &output, io.Discard); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		want := "hello there\n" + strings.ReplaceAll(names, " ", "\n") + "\n/dev/fd/63\n"
+		if output.String() != want {
+			t.Errorf("output = %q, want %q", output.String(), want)
+		}
+	}
+
+	t.Run("ambiguous redirect", func(t *testing.T) {
+		cmd, err := yup.Parse(context.Background(), "cat > $YUP_UNSET", registry)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		var stderr strings.Builder
+		err = cmd.Execute(context.Background(), strings.NewReader(""), io.Discard, &stderr)
+		if yup.ExitStatus(err) != yup.StatusFailure || !strings.Contains(stderr.String(), "ambiguous redirect") {
+			t.Errorf("Execute() = %v, stderr %q", err, stderr.String())
+		}
+	})
+
+	t.Run("assignments", func(t *testing.T) {
+		printenv := func(parameters ...any) yup.Command {
+			return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+				for _, p := range parameters {
+					_, _ = fmt.Fprintf(stdout, "%s=%s\n", p, yup.EnvFrom(ctx).Vars[p.(string)])
+				}
+				return nil
+			})
+		}
+		line := `A=1 B="$A x" printenv A B $A`
+		described, err := yup.Parse(context.Background(), line, yup.Commands{"printenv": named("printenv")})
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if got, want := yup.Describe(described), `A=1 B="${A}"' x' printenv A B ${A}`; got != want {
+			t.Errorf("Describe() = %q, want %q", got, want)
+		}
+
+		// The assignments reach the command alone, after its words expand
+		cmd, err := yup.Parse(context.Background(), line, yup.Commands{"printenv": printenv})
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		env := &yup.Env{Vars: map[string]string{"A": "0"}}
+		var output strings.Builder
+		if err := cmd.Execute(yup.WithEnv(context.Background(), env), strings.NewReader(""), &output, io.Discard); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if want := "A=1\nB=1 x\n0=\n"; output.String() != want {
+			t.Errorf("output = %q, want %q", output.String(), want)
+		}
+		if env.Vars["A"] != "0" {
+			t.Errorf("assignment changed the Env: A=%q", env.Vars["A"])
+		}
+
+		// On their own they set shell variables, which need a shell
+		cmd, err = yup.Parse(context.Background(), "A=1", registry)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		var stderr strings.Builder
+		err = cmd.Execute(yup.WithEnv(context.Background(), env), strings.NewReader(""), io.Discard, &stderr)
+		if yup.ExitStatus(err) != yup.StatusFailure || stderr.String() != "A: no shell environment\n" {
+			t.Errorf("Execute() = %v, stderr %q", err, stderr.String())
+		}
+	})
+
+	t.Run("command name", func(t *testing.T) {
+		cmd, err := yup.Parse(context.Background(), "$YUP_CMD x", registry)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		env := &yup.Env{Vars: map[string]string{"YUP_CMD": "nosuch"}}
+		var stderr strings.Builder
+		err = cmd.Execute(yup.WithEnv(context.Background(), env), strings.NewReader(""), io.Discard, &stderr)
+		if yup.ExitStatus(err) != yup.StatusNotFound || stderr.String() != "nosuch: command not found\n" {
+			t.Errorf("Execute() = %v, stderr %q", err, stderr.String())
+		}
+	})
+}
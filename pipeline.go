@@ -2,7 +2,10 @@ package yup
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"sync"
 
 	"github.com/yupsh/framework/opt"
@@ -16,11 +19,16 @@ type Pipeline struct {
 
 // ExecutionFlags controls how the pipeline is executed
 type ExecutionFlags struct {
-	PipeFail bool // Fail pipeline if any command fails
-	Buffered bool // Use buffered I/O between commands
-	Verbose  bool // Verbose execution logging
-	DryRun   bool // Show commands without executing
-	MaxProcs int  // Maximum number of parallel processes
+	PipeFail   bool // Fail pipeline if any command fails
+	Buffered   bool // Use buffered I/O between commands
+	BufferSize int  // Size of each inter-stage buffer (default: DefaultBufferSize)
+	Spill      bool // Overflow full buffers to a temporary file instead of blocking
+	Verbose    bool // Verbose execution logging
+	DryRun     bool // Show commands without executing
+	MaxProcs   int  // Maximum number of concurrent commands (0 for no limit)
+
+	TraceWriter io.Writer    // Destination for Verbose trace lines (default: stderr)
+	TraceLogger *slog.Logger // Structured destination for Verbose trace events
 }
 
 // Execution flag types
@@ -38,6 +46,16 @@ const (
 	Unbuffered BufferedFlag = false
 )
 
+// BufferSize sets the capacity in bytes of each inter-stage buffer
+type BufferSize int
+
+type SpillFlag bool
+
+const (
+	Spill   SpillFlag = true
+	NoSpill SpillFlag = false
+)
+
 type VerboseFlag bool
 
 const (
@@ -52,12 +70,16 @@ const (
 	NoDryRun DryRunFlag = false
 )
 
-// MaxProcs represents max parallel processes
+// MaxProcs represents max parallel processes. It sizes the scheduler the
+// pipeline creates when the context does not already carry one; see
+// Scheduler for how pipelines and nested commands are admitted.
 type MaxProcs int
 
 // Flag configuration methods
 func (f PipeFailFlag) Configure(flags *ExecutionFlags) { flags.PipeFail = bool(f) }
 func (f BufferedFlag) Configure(flags *ExecutionFlags) { flags.Buffered = bool(f) }
+func (b BufferSize) Configure(flags *ExecutionFlags)   { flags.BufferSize = int(b) }
+func (f SpillFlag) Configure(flags *ExecutionFlags)    { flags.Spill = bool(f) }
 func (f VerboseFlag) Configure(flags *ExecutionFlags)  { flags.Verbose = bool(f) }
 func (f DryRunFlag) Configure(flags *ExecutionFlags)   { flags.DryRun = bool(f) }
 func (m MaxProcs) Configure(flags *ExecutionFlags)     { flags.MaxProcs = int(m) }
@@ -67,7 +89,7 @@ func NewPipeline(commands ...Command) *Pipeline {
 	return &Pipeline{
 		commands: commands,
 		flags: ExecutionFlags{
-			MaxProcs: 1, // Default to sequential execution
+			MaxProcs: 0, // No limit unless set, as after WithFlags
 		},
 	}
 }
@@ -90,34 +112,79 @@ func configure[T any](opts ...opt.Switch[T]) T {
 	return *def
 }
 
-// Execute runs the pipeline with the given input/output
+// Execute runs the pipeline with the given input/output. It returns the
+// last stage's error, or with PipeFail the rightmost stage error; use Run
+// to inspect every stage.
 func (p *Pipeline) Execute(ctx context.Context, input io.Reader, output, stderr io.Writer) error {
+	_, err := p.Run(ctx, input, output, stderr)
+	return err
+}
+
+// Run executes the pipeline and reports the outcome of each stage. The
+// returned error is the pipeline's error as described on Execute, or the
+// reason the pipeline could not start.
+func (p *Pipeline) Run(ctx context.Context, input io.Reader, output, stderr io.Writer) (*Result, error) {
+	return p.run(ctx, input, output, stderr, nil)
+}
+
+// run executes the pipeline, counting each stage's I/O into counters when
+// they are given (one per command)
+func (p *Pipeline) run(ctx context.Context, input io.Reader, output, stderr io.Writer, counters []*stageCounters) (*Result, error) {
+	result := &Result{PipeFail: p.flags.PipeFail}
 	if len(p.commands) == 0 {
-		return nil
+		return result, nil
+	}
+
+	if p.flags.DryRun {
+		_, _ = fmt.Fprintln(stderr, p.Describe())
+		return result, nil
+	}
+
+	sched := SchedulerFrom(ctx)
+	if sched == nil {
+		sched = NewScheduler(p.flags.MaxProcs)
+		ctx = WithScheduler(ctx, sched)
+	}
+
+	// All stages are connected by pipes, so they are admitted together
+	ctx, release, err := sched.Acquire(ctx, len(p.commands))
+	if err != nil {
+		return result, err
+	}
+	defer release()
+
+	trace := newTracer(p.flags, stderr)
+	if counters == nil {
+		counters = make([]*stageCounters, len(p.commands))
 	}
+	result.Stages = make([]StageResult, len(p.commands))
 
 	if len(p.commands) == 1 {
-		return p.commands[0].Execute(ctx, input, output, stderr)
+		err := trace.run(ctx, 0, p.commands[0], input, output, stderr, counters[0])
+		result.Stages[0] = stageResult(err)
+		return result, result.Err()
 	}
 
 	// Create pipes between commands
-	pipes := make([]*io.PipeWriter, len(p.commands)-1)
-	readers := make([]*io.PipeReader, len(p.commands)-1)
+	pipes := make([]pipeWriter, len(p.commands)-1)
+	readers := make([]pipeReader, len(p.commands)-1)
 
 	for i := 0; i < len(p.commands)-1; i++ {
-		readers[i], pipes[i] = io.Pipe()
+		readers[i], pipes[i] = newPipe(p.flags)
 	}
 
-	// Error collection
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(p.commands))
-
 	// Execute commands
+	var wg sync.WaitGroup
 	for i, cmd := range p.commands {
 		wg.Add(1)
 		go func(i int, cmd Command) {
 			defer wg.Done()
 
+			// A stage whose output is closed downstream is stopped, like a
+			// process receiving SIGPIPE
+			stageCtx, cancel := context.WithCancelCause(ctx)
+			defer cancel(nil)
+
 			var cmdInput io.Reader
 			var cmdOutput io.Writer
 
@@ -132,41 +199,59 @@ func (p *Pipeline) Execute(ctx context.Context, input io.Reader, output, stderr
 			if i == len(p.commands)-1 {
 				cmdOutput = output
 			} else {
-				cmdOutput = pipes[i]
+				cmdOutput = sigpipeWriter{w: pipes[i], cancel: cancel}
 			}
 
 			// Execute command
-			err := cmd.Execute(ctx, cmdInput, cmdOutput, stderr)
+			err := trace.run(stageCtx, i, cmd, cmdInput, cmdOutput, stderr, counters[i])
 
 			// Close output pipe if not the last command
 			if i < len(p.commands)-1 {
-				pipes[i].Close()
+				_ = pipes[i].Close()
+			}
+
+			// Close input pipe so upstream writes fail instead of blocking
+			if i > 0 {
+				_ = readers[i-1].CloseWithError(ErrBrokenPipe)
 			}
 
-			// Handle errors based on pipefail setting
-			if err != nil {
-				if p.flags.PipeFail {
-					errChan <- err
-				}
+			if err != nil && ctx.Err() == nil && errors.Is(context.Cause(stageCtx), ErrBrokenPipe) {
+				err = ErrBrokenPipe
 			}
+
+			// Each goroutine owns its own slot
+			result.Stages[i] = stageResult(err)
 		}(i, cmd)
 	}
 
 	// Wait for all commands to complete
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
-
-	// Collect errors
-	var firstErr error
-	for err := range errChan {
-		if firstErr == nil {
-			firstErr = err
-		}
+	wg.Wait()
+
+	return result, result.Err()
+}
+
+// stageResult records the error a stage returned along with its status. A
+// broken pipe keeps status 141, as bash's PIPESTATUS shows it.
+func stageResult(err error) StageResult {
+	status := ExitStatus(err)
+	if status == StatusSuccess {
+		err = nil
 	}
+	return StageResult{Status: status, Err: err}
+}
+
+// sigpipeWriter cancels its stage once the downstream reader has gone away
+type sigpipeWriter struct {
+	w      io.Writer
+	cancel context.CancelCauseFunc
+}
 
-	return firstErr
+func (s sigpipeWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if errors.Is(err, ErrBrokenPipe) {
+		s.cancel(ErrBrokenPipe)
+	}
+	return n, err
 }
 
 // Pipe creates a pipeline from multiple commands (convenience function)
@@ -0,0 +1,85 @@
+package yup_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	yup "github.com/yupsh/framework"
+)
+
+// head copies the first n lines of stdin and returns without reading more
+func head(n int) yup.Command {
+	return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		scanner := bufio.NewScanner(stdin)
+		for i := 0; i < n && scanner.Scan(); i++ {
+			_, _ = fmt.Fprintln(stdout, scanner.Text())
+		}
+		return scanner.Err()
+	})
+}
+
+func TestPipelineBrokenPipe(t *testing.T) {
+	// yes stops on the first failed write
+	yes := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		for {
+			if _, err := fmt.Fprintln(stdout, "y"); err != nil {
+				return err
+			}
+		}
+	})
+	// stubbornYes ignores write errors and only watches its context
+	stubbornYes := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		for {
+			if err := yup.CheckContextCancellation(ctx); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintln(stdout, "y")
+		}
+	})
+
+	tests := []struct {
+		name     string
+		producer yup.Command
+		buffered bool
+	}{
+		{"write error", yes, false},
+		{"context cancellation", stubbornYes, false},
+		{"buffered write error", yes, true},
+		{"buffered context cancellation", stubbornYes, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output strings.Builder
+			done := make(chan struct{})
+			var result *yup.Result
+			var err error
+			go func() {
+				defer close(done)
+				result, err = yup.Pipe(tt.producer, passthrough, head(3)).
+					WithFlags(yup.PipeFail, yup.BufferedFlag(tt.buffered), yup.BufferSize(16)).
+					Run(context.Background(), strings.NewReader(""), &output, io.Discard)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Pipeline did not terminate after the last stage returned")
+			}
+			if err != nil {
+				t.Errorf("Expected clean termination under PipeFail, got %v (statuses %v)", err, result.PipeStatus())
+			}
+			// Like bash's PIPESTATUS, stopped writers show SIGPIPE
+			if got, want := fmt.Sprint(result.PipeStatus()), "[141 141 0]"; got != want {
+				t.Errorf("PipeStatus() = %s, want %s", got, want)
+			}
+			if output.String() != "y\ny\ny\n" {
+				t.Errorf("Expected 3 lines, got %q", output.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package yup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Substitution stands in for a filename with the output of a command, like
+// the shell's <(cmd). Pass it to Substitute among the arguments of a
+// command constructor.
+type Substitution struct {
+	cmd  Command
+	name string
+}
+
+// Sub creates a process substitution for cmd
+func Sub(cmd Command) *Substitution {
+	return &Substitution{cmd: cmd}
+}
+
+// Positional lets opt.Args place the substitution among string arguments,
+// as the name Substitute gave it
+func (s *Substitution) Positional() string {
+	return s.name
+}
+
+// Describe renders the substitution as <(cmd)
+func (s *Substitution) Describe() string {
+	return "<(" + Describe(s.cmd) + ")"
+}
+
+// firstSubstitutionFD mirrors the descriptor numbers bash hands out
+const firstSubstitutionFD = 63
+
+// substitutionName returns the name of the i'th substitution of a command
+func substitutionName(i int) string {
+	return fmt.Sprintf("/dev/fd/%d", firstSubstitutionFD+i)
+}
+
+// substituted runs a command whose arguments name process substitutions
+type substituted struct {
+	cmd  Command
+	subs map[string]*Substitution
+}
+
+// Substitute builds a command with ctor, naming each *Substitution among
+// parameters, such as /dev/fd/63, before passing it on; opt.Args puts the
+// name among the positional arguments. The names mean something only
+// while that command runs: the file helpers and StdinFrom run the
+// substituted command when its name is opened, with the stderr of the
+// command reading it, and cancel and wait for it when the InputSource is
+// closed. Like the pipe the shell creates, each name can be opened once per
+// run; opening it again fails as if the file did not exist. Other names
+// under /dev/fd open as usual. Substitutions that are never opened never
+// run.
+func Substitute(ctor Constructor, parameters ...any) Command {
+	subs := map[string]*Substitution{}
+	args := make([]any, len(parameters))
+	for i, param := range parameters {
+		if sub, ok := param.(*Substitution); ok {
+			name := substitutionName(len(subs))
+			param = &Substitution{cmd: sub.cmd, name: name}
+			subs[name] = param.(*Substitution)
+		}
+		args[i] = param
+	}
+	return substitute(ctor(args...), subs)
+}
+
+// substitute wraps cmd so that the names in subs are open to it
+func substitute(cmd Command, subs map[string]*Substitution) Command {
+	if len(subs) == 0 {
+		return cmd
+	}
+	return &substituted{cmd: cmd, subs: subs}
+}
+
+func (s *substituted) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	table := &substitutionTable{pending: make(map[string]*Substitution, len(s.subs)), stderr: stderr}
+	for name, sub := range s.subs {
+		table.pending[name] = sub
+	}
+	err := s.cmd.Execute(context.WithValue(ctx, substitutionsKey{}, table), stdin, stdout, stderr)
+	table.stop()
+	return err
+}
+
+// Describe renders the command with its substitutions in place of their names
+func (s *substituted) Describe() string {
+	names := make([]string, 0, len(s.subs))
+	for name := range s.subs {
+		names = append(names, name)
+	}
+	// Longest first, so that /dev/fd/630 is not read as /dev/fd/63
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		pairs = append(pairs, name, s.subs[name].Describe())
+	}
+	return strings.NewReplacer(pairs...).Replace(Describe(s.cmd))
+}
+
+type substitutionsKey struct{}
+
+// substitutionTable holds the substitutions of one run of a command
+type substitutionTable struct {
+	mu      sync.Mutex
+	pending map[string]*Substitution // nil once opened
+	running []func() error           // closers of those opened
+	stopped bool
+	stderr  io.Writer // the stderr of the command the names belong to
+}
+
+// stop cancels the substituted commands the run left open, and waits for
+// them
+func (t *substitutionTable) stop() {
+	t.mu.Lock()
+	t.stopped = true
+	running := t.running
+	t.mu.Unlock()
+	for _, closer := range running {
+		_ = closer()
+	}
+}
+
+// openSubstitution starts the substitution named name. It reports false for
+// names the command running with ctx has not been given, which are files
+// like any other, and fails for those it has opened already.
+func openSubstitution(ctx context.Context, name string) (InputSource, bool, error) {
+	table, _ := ctx.Value(substitutionsKey{}).(*substitutionTable)
+	if table == nil {
+		return InputSource{}, false, nil
+	}
+	table.mu.Lock()
+	sub, given := table.pending[name]
+	if sub != nil {
+		table.pending[name] = nil
+	}
+	stopped := table.stopped
+	table.mu.Unlock()
+	if !given {
+		return InputSource{}, false, nil
+	}
+	if sub == nil || stopped {
+		return InputSource{}, true, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	source, err := sub.start(ctx, name, table.stderr)
+	if err != nil {
+		return InputSource{}, true, err
+	}
+	source.closer = sync.OnceValue(source.closer)
+	table.mu.Lock()
+	stopped = table.stopped
+	table.running = append(table.running, source.closer)
+	table.mu.Unlock()
+	if stopped {
+		_ = source.closer()
+	}
+	return source, true, nil
+}
+
+// start runs the substituted command and returns an input source reading
+// its output. Closing the source cancels the command and waits for it.
+func (s *Substitution) start(ctx context.Context, name string, stderr io.Writer) (InputSource, error) {
+	// The command runs alongside the one reading it
+	ctx, release, err := acquireFanOut(ctx, 2)
+	if err != nil {
+		return InputSource{}, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	// The names of the reading command mean nothing to this one
+	ctx = context.WithValue(ctx, substitutionsKey{}, (*substitutionTable)(nil))
+
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		defer release()
+		err := s.cmd.Execute(ctx, strings.NewReader(""), writer, stderr)
+		// A failure reaches the reader in place of EOF
+		_ = writer.CloseWithError(err)
+		done <- err
+	}()
+
+	closer := func() error {
+		cancel()
+		_ = reader.CloseWithError(ErrBrokenPipe)
+		err := <-done
+		// Stopping the command early is how closing works, not a failure
+		if result := stageResult(err); result.failed() && !errors.Is(err, context.Canceled) {
+			return result.Err
+		}
+		return nil
+	}
+	return InputSource{Reader: reader, Filename: name, closer: closer}, nil
+}
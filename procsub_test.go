@@ -0,0 +1,198 @@
+package yup_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	yup "github.com/yupsh/framework"
+	"github.com/yupsh/framework/opt"
+)
+
+// files returns the positional arguments of a test command, taking
+// substitutions as their names the way opt.Args does
+func files(parameters []any) []string {
+	return opt.Args[string, struct{}](parameters...).Positional
+}
+
+// headCat copies its files to stdout with a header before each
+func headCat(parameters ...any) yup.Command {
+	files := files(parameters)
+	return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		return yup.ProcessFilesWithContext(ctx, files, stdin, stdout, stderr,
+			yup.FileProcessorOptions{CommandName: "test", ShowHeaders: true},
+			func(ctx context.Context, source yup.InputSource, output io.Writer) error {
+				_, err := io.Copy(output, source.Reader)
+				return err
+			})
+	})
+}
+
+func TestSubstitution(t *testing.T) {
+	t.Run("positional argument", func(t *testing.T) {
+		diff := yup.Substitute(named("diff"), yup.Sub(named("sort")("a.txt")), yup.Sub(named("sort")("b.txt")))
+		if got, want := yup.Describe(diff), "diff <(sort a.txt) <(sort b.txt)"; got != want {
+			t.Errorf("Describe() = %q, want %q", got, want)
+		}
+
+		cmd := yup.Substitute(headCat, "-", yup.Sub(echo("substituted", 0)))
+
+		// Every run starts afresh
+		for run := 0; run < 2; run++ {
+			var output, stderr strings.Builder
+			if err := cmd.Execute(context.Background(), strings.NewReader("stdin\n"), &output, &stderr); err != nil {
+				t.Fatalf("Unexpected error: %v (%s)", err, stderr.String())
+			}
+			want := "==> stdin <==\nstdin\n==> /dev/fd/63 <==\nsubstituted\n"
+			if output.String() != want {
+				t.Errorf("Run %d: expected %q, got %q", run, want, output.String())
+			}
+		}
+	})
+
+	t.Run("redirected stdin", func(t *testing.T) {
+		stdinFrom := func(parameters ...any) yup.Command {
+			return yup.Redirect(catFiles(), yup.StdinFrom(files(parameters)[0]))
+		}
+		var output strings.Builder
+		err := yup.Substitute(stdinFrom, yup.Sub(echo("redirected", 0))).
+			Execute(context.Background(), strings.NewReader(""), &output, io.Discard)
+		if err != nil || output.String() != "redirected\n" {
+			t.Errorf("Expected the substitution on stdin, got %q (%v)", output.String(), err)
+		}
+	})
+
+	t.Run("reopening fails", func(t *testing.T) {
+		reopen := func(parameters ...any) yup.Command {
+			name := files(parameters)[0]
+			return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+				sources, err := yup.CollectInputSourcesWithContext(ctx, []string{name}, stdin)
+				if err != nil {
+					return err
+				}
+				defer func() { _ = yup.CloseInputSources(sources) }()
+				// Like the shell's pipe, a substitution is consumed by opening it
+				_, err = yup.CollectInputSourcesWithContext(ctx, []string{name}, stdin)
+				return err
+			})
+		}
+		err := yup.Substitute(reopen, yup.Sub(echo("x", 0))).
+			Execute(context.Background(), strings.NewReader(""), io.Discard, io.Discard)
+		if err == nil || !strings.HasSuffix(err.Error(), fs.ErrNotExist.Error()) {
+			t.Errorf("Expected reopening to fail as not existing, got %v", err)
+		}
+	})
+
+	t.Run("other descriptors open as files", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("no /dev/fd")
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		_, _ = io.WriteString(w, "piped\n")
+		_ = w.Close()
+
+		var output strings.Builder
+		name := fmt.Sprintf("/dev/fd/%d", r.Fd())
+		err = yup.Substitute(headCat, name, yup.Sub(echo("substituted", 0))).
+			Execute(context.Background(), strings.NewReader(""), &output, io.Discard)
+		want := "==> " + name + " <==\npiped\n==> /dev/fd/63 <==\nsubstituted\n"
+		if err != nil || output.String() != want {
+			t.Errorf("Got %q (%v), want %q", output.String(), err, want)
+		}
+	})
+
+	t.Run("unopened substitutions never run", func(t *testing.T) {
+		var started atomic.Bool
+		record := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			started.Store(true)
+			return nil
+		})
+		ignore := func(parameters ...any) yup.Command { return passthrough }
+		if err := yup.Substitute(ignore, yup.Sub(record)).
+			Execute(context.Background(), strings.NewReader(""), io.Discard, io.Discard); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if started.Load() {
+			t.Error("Expected an unopened substitution not to run")
+		}
+	})
+
+	t.Run("closing stops the command", func(t *testing.T) {
+		stopped := make(chan struct{})
+		endless := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			defer close(stopped)
+			for {
+				if _, err := fmt.Fprintln(stdout, "y"); err != nil {
+					return err
+				}
+			}
+		})
+
+		firstLine := func(parameters ...any) yup.Command {
+			return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+				sources, err := yup.CollectInputSourcesWithContext(ctx, files(parameters), stdin)
+				if err != nil {
+					return err
+				}
+				line, _ := bufio.NewReader(sources[0].Reader).ReadString('\n')
+				_, _ = io.WriteString(stdout, line)
+				return yup.CloseInputSources(sources)
+			})
+		}
+		var output strings.Builder
+		err := yup.Substitute(firstLine, yup.Sub(endless)).
+			Execute(context.Background(), strings.NewReader(""), &output, io.Discard)
+		if err != nil {
+			t.Errorf("Expected clean close, got %v", err)
+		}
+		if output.String() != "y\n" {
+			t.Errorf("Expected a line from the substitution, got %q", output.String())
+		}
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("Substituted command still running after close")
+		}
+	})
+
+	t.Run("failure reaches the reader", func(t *testing.T) {
+		failing := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			_, _ = fmt.Fprintln(stderr, "failing: boom")
+			return yup.Exit(3)
+		})
+		readAll := func(parameters ...any) yup.Command {
+			return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+				sources, err := yup.CollectInputSourcesWithContext(ctx, files(parameters), stdin)
+				if err != nil {
+					return err
+				}
+				_, err = io.ReadAll(sources[0].Reader)
+				_ = yup.CloseInputSources(sources)
+				return err
+			})
+		}
+
+		var stderr strings.Builder
+		err := yup.Substitute(readAll, yup.Sub(failing)).
+			Execute(context.Background(), strings.NewReader(""), io.Discard, &stderr)
+		if yup.ExitStatus(err) != 3 {
+			t.Errorf("Expected status 3, got %v", err)
+		}
+		// The substituted command shares the stderr of the one reading it
+		if stderr.String() != "failing: boom\n" {
+			t.Errorf("Expected the substitution's stderr, got %q", stderr.String())
+		}
+	})
+}
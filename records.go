@@ -0,0 +1,233 @@
+package yup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"regexp"
+)
+
+// Record is one record of input, as read by a RecordReader
+type Record struct {
+	Num        int    // 1-based number of the record
+	Data       string // The record without its terminator
+	Terminator string // What ended the record, "" if the input ended first
+}
+
+// Terminated reports whether the record ended with a terminator; only the
+// last record of an input can lack one
+func (r Record) Terminated() bool {
+	return r.Terminator != ""
+}
+
+// String returns the record as it appeared in the input
+func (r Record) String() string {
+	return r.Data + r.Terminator
+}
+
+// Separator says where one record ends and the next begins. The
+// separators are Lines, NUL, Paragraphs, Delimiter and Pattern.
+type Separator interface {
+	// split is a bufio.SplitFunc whose token includes the terminator,
+	// of which termLen bytes end the token. Asking for more input, it
+	// sets termLen to how many bytes at the end of data may belong to a
+	// terminator, so that the rest is known to be record data.
+	split(data []byte, atEOF bool) (advance int, token []byte, termLen int)
+}
+
+var (
+	// Lines separates records at "\n", taking a "\r\n" whole, so that
+	// input with either ending is reproduced exactly
+	Lines Separator = lineSeparator{}
+
+	// NUL separates records at NUL bytes, as -z and -0 options do
+	NUL Separator = Delimiter("\x00")
+
+	// Paragraphs separates records at runs of blank lines and skips
+	// blank lines at the start, as awk does with RS=""
+	Paragraphs Separator = paragraphSeparator{}
+)
+
+// Delimiter separates records at every occurrence of sep
+func Delimiter(sep string) Separator {
+	if sep == "" {
+		panic("yup: empty record delimiter")
+	}
+	return delimiter(sep)
+}
+
+// Pattern separates records at every non-empty match of re, as awk does
+// with a regular expression RS. Matches are looked for in the input read so
+// far, which grows until one is found, so re should match only separators.
+// Under WithMaxLineLength a record is known to be too long only once it
+// runs patternLookahead bytes past the cap without a match.
+func Pattern(re *regexp.Regexp) Separator {
+	return patternSeparator{re}
+}
+
+type lineSeparator struct{}
+
+func (lineSeparator) split(data []byte, atEOF bool) (int, []byte, int) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		if i > 0 && data[i-1] == '\r' {
+			return i + 1, data[:i+1], 2
+		}
+		return i + 1, data[:i+1], 1
+	}
+	// A trailing "\r" may start a "\r\n"
+	return final(data, atEOF, 1)
+}
+
+type delimiter string
+
+func (d delimiter) split(data []byte, atEOF bool) (int, []byte, int) {
+	if i := bytes.Index(data, []byte(d)); i >= 0 {
+		end := i + len(d)
+		return end, data[:end], len(d)
+	}
+	return final(data, atEOF, len(d)-1)
+}
+
+type paragraphSeparator struct{}
+
+func (paragraphSeparator) split(data []byte, atEOF bool) (int, []byte, int) {
+	// Blank lines before the first paragraph
+	if skip := len(data) - len(bytes.TrimLeft(data, "\n")); skip > 0 {
+		return skip, nil, 0
+	}
+
+	i := bytes.Index(data, []byte("\n\n"))
+	if i < 0 {
+		if atEOF && bytes.HasSuffix(data, []byte("\n")) {
+			return len(data), data, 1
+		}
+		return final(data, atEOF, 1)
+	}
+	end := i + 2
+	for end < len(data) && data[end] == '\n' {
+		end++
+	}
+	if end == len(data) && !atEOF {
+		return 0, nil, end - i // the run of blank lines may go on
+	}
+	return end, data[:end], end - i
+}
+
+type patternSeparator struct {
+	re *regexp.Regexp
+}
+
+func (p patternSeparator) split(data []byte, atEOF bool) (int, []byte, int) {
+	for _, match := range p.re.FindAllIndex(data, -1) {
+		start, end := match[0], match[1]
+		if start == end {
+			continue
+		}
+		if end == len(data) && !atEOF {
+			return 0, nil, end - start // the match may go on
+		}
+		return end, data[:end], end - start
+	}
+	return final(data, atEOF, patternLookahead)
+}
+
+// patternLookahead is how much of the input read so far a Pattern match
+// not yet found may still begin in
+const patternLookahead = 1024
+
+// final returns the unterminated record at the end of the input, or asks
+// for more input, of which the last partial bytes may start a terminator
+func final(data []byte, atEOF bool, partial int) (int, []byte, int) {
+	if atEOF && len(data) > 0 {
+		return len(data), data, 0
+	}
+	return 0, nil, min(partial, len(data))
+}
+
+// RecordReader reads records from an input, like a bufio.Scanner that
+// keeps the terminators. Records may be any length unless the context caps
+// them with WithMaxLineLength, which terminators do not count towards.
+type RecordReader struct {
+	ctx     context.Context
+	scanner *bufio.Scanner
+	max     int
+	termLen int
+	record  Record
+	err     error
+}
+
+// NewRecordReader returns a reader of the records of r, split by sep
+func NewRecordReader(ctx context.Context, r io.Reader, sep Separator) *RecordReader {
+	rr := &RecordReader{ctx: ctx, scanner: bufio.NewScanner(r), max: maxLineLength(ctx)}
+	rr.scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, termLen := sep.split(data, atEOF)
+		if token == nil && advance == 0 && rr.max > 0 && len(data)-termLen > rr.max {
+			// Stop reading a record already too long, however long its
+			// terminator would be
+			return 0, nil, bufio.ErrTooLong
+		}
+		rr.termLen = termLen
+		return advance, token, nil
+	})
+	rr.scanner.Buffer(nil, math.MaxInt)
+	return rr
+}
+
+// Next advances to the next record, returning false at the end of the
+// input, on an error or once the context is cancelled
+func (r *RecordReader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if err := CheckContextCancellation(r.ctx); err != nil {
+		r.err = err
+		return false
+	}
+
+	num := r.record.Num + 1
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); errors.Is(err, bufio.ErrTooLong) && r.max > 0 {
+			r.err = &LineTooLongError{Line: num, Max: r.max}
+		} else {
+			r.err = err
+		}
+		return false
+	}
+
+	token := r.scanner.Bytes()
+	cut := len(token) - r.termLen
+	r.record = Record{Num: num, Data: string(token[:cut]), Terminator: string(token[cut:])}
+	if r.max > 0 && cut > r.max {
+		r.err = &LineTooLongError{Line: num, Max: r.max}
+		return false
+	}
+	return true
+}
+
+// Record returns the record read by the last call to Next
+func (r *RecordReader) Record() Record {
+	return r.record
+}
+
+// Err returns the error that stopped Next, if any
+func (r *RecordReader) Err() error {
+	return r.err
+}
+
+// RecordProcessor is a function that processes individual records with context support
+type RecordProcessor func(ctx context.Context, record Record, output io.Writer) error
+
+// ProcessRecordsWithContext reads records from a reader, split by sep, and processes each one
+// with context cancellation support
+func ProcessRecordsWithContext(ctx context.Context, reader io.Reader, output io.Writer, sep Separator, processor RecordProcessor) error {
+	records := NewRecordReader(ctx, reader, sep)
+	for records.Next() {
+		if err := processor(ctx, records.Record(), output); err != nil {
+			return err
+		}
+	}
+	return records.Err()
+}
@@ -0,0 +1,136 @@
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+)
+
+func TestRecordReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		sep   yup.Separator
+		input string
+		want  []string // each record as data|terminator
+	}{
+		{"lines", yup.Lines, "a\nb\r\n\nc", []string{"a|\n", "b|\r\n", "|\n", "c|"}},
+		{"terminated lines", yup.Lines, "a\nb\n", []string{"a|\n", "b|\n"}},
+		{"lone carriage return", yup.Lines, "a\rb\r", []string{"a\rb\r|"}},
+		{"empty", yup.Lines, "", nil},
+		{"nul", yup.NUL, "a b\x00c\nd\x00e", []string{"a b|\x00", "c\nd|\x00", "e|"}},
+		{"paragraphs", yup.Paragraphs, "\n\na\nb\n\n\nc\n", []string{"a\nb|\n\n\n", "c|\n"}},
+		{"unterminated paragraph", yup.Paragraphs, "a\n\nb", []string{"a|\n\n", "b|"}},
+		{"delimiter", yup.Delimiter("--"), "a--b---c", []string{"a|--", "b|--", "-c|"}},
+		{"pattern", yup.Pattern(regexp.MustCompile(`;\s*`)), "a; b;c;  ", []string{"a|; ", "b|;", "c|;  "}},
+		{"pattern skips empty matches", yup.Pattern(regexp.MustCompile(`,*`)), "a,,b", []string{"a|,,", "b|"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := yup.NewRecordReader(context.Background(), strings.NewReader(tt.input), tt.sep)
+			var got []string
+			for records.Next() {
+				record := records.Record()
+				if record.Num != len(got)+1 {
+					t.Errorf("Record %q numbered %d", record.Data, record.Num)
+				}
+				got = append(got, record.Data+"|"+record.Terminator)
+			}
+			if err := records.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessRecordsWithContext(t *testing.T) {
+	copyRecord := func(ctx context.Context, record yup.Record, output io.Writer) error {
+		_, err := io.WriteString(output, record.String())
+		return err
+	}
+
+	t.Run("reproduces input exactly", func(t *testing.T) {
+		input := "dos\r\nunix\n" + strings.Repeat("x", 100*1024) + "\nno newline"
+		var output strings.Builder
+		if err := yup.ProcessRecordsWithContext(context.Background(), strings.NewReader(input), &output, yup.Lines, copyRecord); err != nil {
+			t.Fatal(err)
+		}
+		if output.String() != input {
+			t.Errorf("Output differs from input")
+		}
+	})
+
+	t.Run("final terminator", func(t *testing.T) {
+		for input, want := range map[string]bool{"a\nb\n": true, "a\nb": false} {
+			var last yup.Record
+			_ = yup.ProcessRecordsWithContext(context.Background(), strings.NewReader(input), io.Discard, yup.Lines,
+				func(ctx context.Context, record yup.Record, output io.Writer) error {
+					last = record
+					return nil
+				})
+			if last.Terminated() != want {
+				t.Errorf("%q: Terminated() = %v, want %v", input, last.Terminated(), want)
+			}
+		}
+	})
+
+	t.Run("capped", func(t *testing.T) {
+		ctx := yup.WithMaxLineLength(context.Background(), 4)
+		var output strings.Builder
+		err := yup.ProcessRecordsWithContext(ctx, strings.NewReader("abcd\x00abcde\x00"), &output, yup.NUL, copyRecord)
+		var tooLong *yup.LineTooLongError
+		if !errors.As(err, &tooLong) || tooLong.Line != 2 || output.String() != "abcd\x00" {
+			t.Errorf("Got %q, err %v", output.String(), err)
+		}
+	})
+
+	t.Run("cap excludes terminators", func(t *testing.T) {
+		ctx := yup.WithMaxLineLength(context.Background(), 10)
+		long := strings.Repeat("-", 5000)
+		tests := []struct {
+			name  string
+			sep   yup.Separator
+			input string
+		}{
+			{"paragraphs", yup.Paragraphs, "a\n" + strings.Repeat("\n", 5000) + "b\n"},
+			{"delimiter", yup.Delimiter(long), "a" + long + "b"},
+			{"pattern", yup.Pattern(regexp.MustCompile(`-+`)), "a" + long + "b"},
+		}
+		for _, tt := range tests {
+			var output strings.Builder
+			if err := yup.ProcessRecordsWithContext(ctx, strings.NewReader(tt.input), &output, tt.sep, copyRecord); err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			if output.String() != tt.input {
+				t.Errorf("%s: output differs from input", tt.name)
+			}
+		}
+
+		// A long record still fails without waiting for its terminator
+		r, w := io.Pipe()
+		go func() { _, _ = io.WriteString(w, strings.Repeat("x", 100)) }()
+		err := yup.ProcessRecordsWithContext(ctx, r, io.Discard, yup.Paragraphs, copyRecord)
+		var tooLong *yup.LineTooLongError
+		if !errors.As(err, &tooLong) || tooLong.Line != 1 {
+			t.Errorf("Expected line 1 to be too long, got %v", err)
+		}
+		_ = w.Close()
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := yup.ProcessRecordsWithContext(ctx, strings.NewReader("a\n"), io.Discard, yup.Lines, copyRecord)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
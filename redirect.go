@@ -0,0 +1,222 @@
+package yup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Redirection changes where one of a command's streams comes from or goes
+// to. Redirections are applied left to right, as in the shell, so
+// StdoutTo("f") followed by StderrToStdout sends both streams to f.
+type Redirection interface {
+	apply(s *redirectStreams) error
+	describe() string
+}
+
+// StdinFrom reads stdin from a file (<file)
+type StdinFrom string
+
+// StdoutTo truncates a file and writes stdout to it (>file)
+type StdoutTo string
+
+// StdoutAppend appends stdout to a file (>>file)
+type StdoutAppend string
+
+// StderrTo truncates a file and writes stderr to it (2>file)
+type StderrTo string
+
+// StderrAppend appends stderr to a file (2>>file)
+type StderrAppend string
+
+// StreamDup duplicates one output stream onto the other
+type StreamDup int
+
+const (
+	StderrToStdout StreamDup = iota // 2>&1
+	StdoutToStderr                  // >&2
+)
+
+// redirectStreams holds the streams being rewired and the files opened for them
+type redirectStreams struct {
+	ctx    context.Context
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	files  []io.Closer
+}
+
+// open opens a file for reading through the command's filesystem, in the
+// working directory of its Env, or starts a process substitution
+func (s *redirectStreams) open(name string) (io.Reader, error) {
+	if source, ok, err := openSubstitution(s.ctx, name); ok {
+		if err != nil {
+			return nil, err
+		}
+		s.files = append(s.files, source)
+		return source.Reader, nil
+	}
+	file, err := Open(s.ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.files = append(s.files, file)
+	return file, nil
+}
+
+// create opens a file for writing, with the umask of the command's Env
+func (s *redirectStreams) create(name string, flag int) (io.Writer, error) {
+	file, err := OpenFile(s.ctx, name, flag, 0o666&^umask(s.ctx))
+	if err != nil {
+		return nil, err
+	}
+	s.files = append(s.files, file)
+	return file, nil
+}
+
+func (s *redirectStreams) close() error {
+	var lastError error
+	for _, file := range s.files {
+		if err := file.Close(); err != nil {
+			lastError = err
+		}
+	}
+	return lastError
+}
+
+const (
+	truncateFlags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	appendFlags   = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+)
+
+func (r StdinFrom) apply(s *redirectStreams) error {
+	file, err := s.open(string(r))
+	if err == nil {
+		s.stdin = file
+	}
+	return err
+}
+
+func (r StdoutTo) apply(s *redirectStreams) error {
+	file, err := s.create(string(r), truncateFlags)
+	if err == nil {
+		s.stdout = file
+	}
+	return err
+}
+
+func (r StdoutAppend) apply(s *redirectStreams) error {
+	file, err := s.create(string(r), appendFlags)
+	if err == nil {
+		s.stdout = file
+	}
+	return err
+}
+
+func (r StderrTo) apply(s *redirectStreams) error {
+	file, err := s.create(string(r), truncateFlags)
+	if err == nil {
+		s.stderr = file
+	}
+	return err
+}
+
+func (r StderrAppend) apply(s *redirectStreams) error {
+	file, err := s.create(string(r), appendFlags)
+	if err == nil {
+		s.stderr = file
+	}
+	return err
+}
+
+func (r StreamDup) apply(s *redirectStreams) error {
+	if r == StderrToStdout {
+		s.stderr = s.stdout
+	} else {
+		s.stdout = s.stderr
+	}
+	return nil
+}
+
+func (r StdinFrom) describe() string    { return "<" + QuoteWord(string(r)) }
+func (r StdoutTo) describe() string     { return ">" + QuoteWord(string(r)) }
+func (r StdoutAppend) describe() string { return ">>" + QuoteWord(string(r)) }
+func (r StderrTo) describe() string     { return "2>" + QuoteWord(string(r)) }
+func (r StderrAppend) describe() string { return "2>>" + QuoteWord(string(r)) }
+
+func (r StreamDup) describe() string {
+	if r == StderrToStdout {
+		return "2>&1"
+	}
+	return ">&2"
+}
+
+// redirected runs a command with some of its streams rewired
+type redirected struct {
+	cmd    Command
+	redirs []Redirection
+}
+
+// Redirect wraps cmd so that it runs with the given redirections applied
+func Redirect(cmd Command, redirs ...Redirection) Command {
+	return &redirected{cmd: cmd, redirs: redirs}
+}
+
+// MergeStderr sends cmd's stderr along with its stdout, so that as a
+// pipeline stage it behaves like the shell's |&
+func MergeStderr(cmd Command) Command {
+	return Redirect(cmd, StderrToStdout)
+}
+
+func (r *redirected) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	streams := &redirectStreams{ctx: ctx, stdin: stdin, stdout: stdout, stderr: stderr}
+	for _, redir := range r.redirs {
+		if err := redir.apply(streams); err != nil {
+			_ = streams.close()
+			// Report on the original stderr, as the shell does
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				ErrorF(stderr, commandName(r.cmd), pathErr.Path, pathErr.Err)
+			} else {
+				ErrorF(stderr, commandName(r.cmd), "", err)
+			}
+			return ExitWithError(StatusFailure, err)
+		}
+	}
+
+	err := r.cmd.Execute(ctx, streams.stdin, streams.stdout, streams.stderr)
+	if closeErr := streams.close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Describe renders the command followed by its redirections
+func (r *redirected) Describe() string {
+	words := []string{describeSimple(r.cmd)}
+	for _, redir := range r.redirs {
+		words = append(words, redir.describe())
+	}
+	return strings.Join(words, " ")
+}
+
+// describeSimple renders cmd so that it reads as a single shell command,
+// grouping pipelines and lists that would otherwise bind differently
+func describeSimple(cmd Command) string {
+	switch cmd.(type) {
+	case *Pipeline, *commandList:
+		return group(cmd)
+	}
+	return Describe(cmd)
+}
+
+// commandName returns the name a command is reported under in diagnostics
+func commandName(cmd Command) string {
+	if fields := strings.Fields(Describe(cmd)); len(fields) > 0 {
+		return fields[0]
+	}
+	return "yup"
+}
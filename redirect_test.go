@@ -0,0 +1,89 @@
+package yup_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+)
+
+// chatty copies stdin to stdout and writes a note to stderr
+var chatty = cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	_, _ = fmt.Fprintln(stderr, "note")
+	_, err := io.Copy(stdout, stdin)
+	return err
+})
+
+func TestRedirect(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.txt")
+	out := filepath.Join(dir, "out.txt")
+	if err := os.WriteFile(in, []byte("data\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(cmd yup.Command) (string, string, error) {
+		var stdout, stderr strings.Builder
+		err := cmd.Execute(context.Background(), strings.NewReader("stdin\n"), &stdout, &stderr)
+		return stdout.String(), stderr.String(), err
+	}
+	readOut := func() string {
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	t.Run("stdin and stdout", func(t *testing.T) {
+		stdout, stderr, err := run(yup.Redirect(chatty, yup.StdinFrom(in), yup.StdoutTo(out)))
+		if err != nil || stdout != "" || stderr != "note\n" || readOut() != "data\n" {
+			t.Errorf("Got stdout %q, stderr %q, file %q, err %v", stdout, stderr, readOut(), err)
+		}
+	})
+
+	t.Run("append", func(t *testing.T) {
+		_, _, _ = run(yup.Redirect(chatty, yup.StdoutAppend(out)))
+		if got := readOut(); got != "data\nstdin\n" {
+			t.Errorf("Expected appended output, got %q", got)
+		}
+	})
+
+	t.Run("order matters", func(t *testing.T) {
+		stdout, stderr, _ := run(yup.Redirect(chatty, yup.StdoutTo(out), yup.StderrToStdout))
+		if stdout != "" || stderr != "" || readOut() != "note\nstdin\n" {
+			t.Errorf(">file 2>&1: got stdout %q, stderr %q, file %q", stdout, stderr, readOut())
+		}
+
+		stdout, stderr, _ = run(yup.Redirect(chatty, yup.StderrToStdout, yup.StdoutTo(out)))
+		if stdout != "note\n" || stderr != "" || readOut() != "stdin\n" {
+			t.Errorf("2>&1 >file: got stdout %q, stderr %q, file %q", stdout, stderr, readOut())
+		}
+	})
+
+	t.Run("stderr into the pipe", func(t *testing.T) {
+		stdout, stderr, err := run(yup.Pipe(yup.MergeStderr(chatty), passthrough))
+		if err != nil || stdout != "note\nstdin\n" || stderr != "" {
+			t.Errorf("Got stdout %q, stderr %q, err %v", stdout, stderr, err)
+		}
+	})
+
+	t.Run("missing input file", func(t *testing.T) {
+		_, stderr, err := run(yup.Redirect(chatty, yup.StdinFrom(filepath.Join(dir, "missing"))))
+		if yup.ExitStatus(err) != 1 || !strings.Contains(stderr, "missing: no such file or directory") {
+			t.Errorf("Got stderr %q, err %v", stderr, err)
+		}
+	})
+
+	t.Run("describe", func(t *testing.T) {
+		cmd := yup.Redirect(yup.Pipe(chatty, chatty), yup.StdoutAppend("my log"), yup.StderrToStdout)
+		if got, want := yup.Describe(cmd), "{ framework_test | framework_test; } >>'my log' 2>&1"; got != want {
+			t.Errorf("Describe() = %q, want %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package yup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yupsh/framework/opt"
+)
+
+// Spec describes a command to a Registry: how to construct it and how to
+// explain it in help and completions
+type Spec struct {
+	Name     string
+	New      Constructor
+	Synopsis string     // One-line summary, e.g. "print lines that match patterns"
+	Args     string     // Positional arguments, e.g. "PATTERN [FILE]..."
+	Flags    []opt.Flag // Options, usually opt.FlagsOf of the command's Flags
+
+	// Argv converts command-line words into constructor parameters, usually
+	// opt.Argv of the command's Flags. Without it words are passed through
+	// as positional strings.
+	Argv func(name string, args []string) ([]any, error)
+}
+
+// Construct builds the command from command-line words. Arguments that Argv
+// rejects, and --help, give a command that reports them when run, as
+// a shell would.
+func (s Spec) Construct(args []string) Command {
+	if s.Argv == nil {
+		parameters := make([]any, len(args))
+		for i, arg := range args {
+			parameters[i] = arg
+		}
+		return s.New(parameters...)
+	}
+
+	parameters, err := s.Argv(s.Name, args)
+	if err != nil {
+		return &argvError{spec: s, args: args, err: err}
+	}
+	return s.New(parameters...)
+}
+
+// Usage writes help for the command in the style of coreutils' --help
+func (s Spec) Usage(w io.Writer) {
+	line := "Usage: " + s.Name
+	if len(s.Flags) > 0 {
+		line += " [OPTION]..."
+	}
+	if s.Args != "" {
+		line += " " + s.Args
+	}
+	_, _ = fmt.Fprintln(w, line)
+	if s.Synopsis != "" {
+		_, _ = fmt.Fprintln(w, s.Synopsis)
+	}
+	if len(s.Flags) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintln(w)
+
+	names := make([]string, len(s.Flags))
+	width := 0
+	for i, flag := range s.Flags {
+		short := "    "
+		if flag.Short != "" {
+			short = "-" + flag.Short + ", "
+		}
+		names[i] = short + "--" + flag.Long
+		if flag.Value != "" {
+			names[i] += "=" + flag.Value
+		}
+		width = max(width, len(names[i]))
+	}
+	for i, flag := range s.Flags {
+		_, _ = fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("  %-*s  %s", width, names[i], flag.Usage), " "))
+	}
+}
+
+// Registry is the set of commands known by name, shared by the parser,
+// help, completion and the multi-call binary. It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	specs map[string]Spec
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{specs: map[string]Spec{}}
+}
+
+// DefaultRegistry is the registry used by Register; command modules add
+// themselves to it from an init function
+var DefaultRegistry = NewRegistry()
+
+// Register adds spec to DefaultRegistry
+func Register(spec Spec) {
+	DefaultRegistry.Register(spec)
+}
+
+// Register adds a command. Like database/sql.Register, it panics if the
+// name is empty or taken or the constructor is nil, since those are
+// programming errors found at init time.
+func (r *Registry) Register(spec Spec) {
+	if spec.Name == "" {
+		panic("yup: Register with empty command name")
+	}
+	if spec.New == nil {
+		panic("yup: Register of " + spec.Name + " with nil constructor")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.specs[spec.Name]; dup {
+		panic("yup: Register called twice for " + spec.Name)
+	}
+	r.specs[spec.Name] = spec
+}
+
+// Lookup returns the spec registered under name
+func (r *Registry) Lookup(name string) (Spec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	spec, ok := r.specs[name]
+	return spec, ok
+}
+
+// Resolve returns the constructor registered under name, so a Registry can
+// be given to Parse. Given only strings, the constructor parses them with
+// the spec's Argv; typed parameters are passed through unchanged.
+func (r *Registry) Resolve(name string) (Constructor, bool) {
+	spec, ok := r.Lookup(name)
+	if !ok || spec.Argv == nil {
+		return spec.New, ok
+	}
+	return func(parameters ...any) Command {
+		args := make([]string, len(parameters))
+		for i, p := range parameters {
+			arg, isString := p.(string)
+			if !isString {
+				return spec.New(parameters...)
+			}
+			args[i] = arg
+		}
+		return spec.Construct(args)
+	}, true
+}
+
+// Specs returns every registered command ordered by name
+func (r *Registry) Specs() []Spec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	specs := make([]Spec, 0, len(r.specs))
+	for _, spec := range r.specs {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, k int) bool { return specs[i].Name < specs[k].Name })
+	return specs
+}
+
+// Names returns the registered command names in order, optionally only
+// those starting with prefix, as completion wants
+func (r *Registry) Names(prefix string) []string {
+	var names []string
+	for _, spec := range r.Specs() {
+		if strings.HasPrefix(spec.Name, prefix) {
+			names = append(names, spec.Name)
+		}
+	}
+	return names
+}
+
+// argvError stands in for a command whose arguments could not be parsed
+type argvError struct {
+	spec Spec
+	args []string
+	err  error
+}
+
+func (a *argvError) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	if errors.Is(a.err, opt.ErrHelp) {
+		a.spec.Usage(stdout)
+		return nil
+	}
+	reportUsage(stderr, a.err)
+	return ExitWithError(StatusUsage, a.err)
+}
+
+// Describe renders the command line as it was given
+func (a *argvError) Describe() string {
+	words := []string{QuoteWord(a.spec.Name)}
+	for _, arg := range a.args {
+		words = append(words, QuoteWord(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// reportUsage writes a usage error and, for an opt.UsageError, the hint
+// that follows it in coreutils
+func reportUsage(stderr io.Writer, err error) {
+	_, _ = fmt.Fprintln(stderr, err)
+	var usageErr *opt.UsageError
+	if errors.As(err, &usageErr) {
+		_, _ = fmt.Fprintln(stderr, usageErr.Hint())
+	}
+}
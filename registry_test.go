@@ -0,0 +1,121 @@
+package yup_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+	"github.com/yupsh/framework/opt"
+)
+
+type searchFlags struct {
+	IgnoreCase bool   `flag:"i,ignore-case" usage:"ignore case distinctions"`
+	MaxCount   int    `flag:"m" value:"NUM" usage:"stop after NUM matches"`
+	Invert     bool   `flag:"v,invert-match" usage:"select non-matching lines"`
+	Label      string `usage:"use LABEL as the name of standard input" value:"LABEL"`
+	internal   bool
+	Debug      bool `flag:"-"`
+}
+
+func searchSpec() yup.Spec {
+	return yup.Spec{
+		Name:     "search",
+		New:      named("search"),
+		Synopsis: "Search for PATTERN in each FILE.",
+		Args:     "PATTERN [FILE]...",
+		Flags:    opt.FlagsOf[searchFlags](),
+	}
+}
+
+func ExampleSpec_Usage() {
+	searchSpec().Usage(os.Stdout)
+	// Output:
+	// Usage: search [OPTION]... PATTERN [FILE]...
+	// Search for PATTERN in each FILE.
+	//
+	//   -i, --ignore-case    ignore case distinctions
+	//   -m, --max-count=NUM  stop after NUM matches
+	//   -v, --invert-match   select non-matching lines
+	//       --label=LABEL    use LABEL as the name of standard input
+}
+
+func TestRegistry(t *testing.T) {
+	registry := yup.NewRegistry()
+	registry.Register(searchSpec())
+	registry.Register(yup.Spec{Name: "sort", New: named("sort")})
+	registry.Register(yup.Spec{Name: "cat", New: named("cat")})
+
+	if got, want := registry.Names(""), []string{"cat", "search", "sort"}; !slices.Equal(got, want) {
+		t.Errorf("Names() = %q, want %q", got, want)
+	}
+	if got, want := registry.Names("s"), []string{"search", "sort"}; !slices.Equal(got, want) {
+		t.Errorf("Names(s) = %q, want %q", got, want)
+	}
+	if spec, ok := registry.Lookup("search"); !ok || len(spec.Flags) != 4 {
+		t.Errorf("Lookup(search) = %+v, %v", spec, ok)
+	}
+	if _, ok := registry.Lookup("grep"); ok {
+		t.Error("Lookup(grep) found an unregistered command")
+	}
+
+	cmd, err := yup.Parse(context.Background(), "cat a | sort", registry)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := yup.Describe(cmd); got != "cat a | sort" {
+		t.Errorf("Parse() = %q", got)
+	}
+}
+
+func TestRegistryRejectsBadSpecs(t *testing.T) {
+	tests := []struct {
+		name string
+		spec yup.Spec
+	}{
+		{"empty name", yup.Spec{New: named("x")}},
+		{"nil constructor", yup.Spec{Name: "x"}},
+		{"duplicate", yup.Spec{Name: "cat", New: named("cat")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := yup.NewRegistry()
+			registry.Register(yup.Spec{Name: "cat", New: named("cat")})
+			defer func() {
+				if recover() == nil {
+					t.Error("Register() did not panic")
+				}
+			}()
+			registry.Register(tt.spec)
+		})
+	}
+}
+
+func TestFlagsOf(t *testing.T) {
+	var got []string
+	for _, f := range opt.FlagsOf[searchFlags]() {
+		got = append(got, fmt.Sprintf("%s %s %s %q bool=%v", f.Field, f.Short, f.Long, f.Value, f.IsBool()))
+	}
+	want := []string{
+		`IgnoreCase i ignore-case "" bool=true`,
+		`MaxCount m max-count "NUM" bool=false`,
+		`Invert v invert-match "" bool=true`,
+		`Label  label "LABEL" bool=false`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("FlagsOf() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestDescribeUsesFlagTags(t *testing.T) {
+	cmd := yup.StandardCommand[searchFlags]{
+		Name:       "search",
+		Positional: []string{"foo"},
+		Flags:      searchFlags{Invert: true, MaxCount: 3, Debug: true},
+	}
+	if got, want := cmd.Describe(), "search --max-count=3 --invert-match foo"; got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+}
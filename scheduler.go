@@ -0,0 +1,219 @@
+package yup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Scheduler bounds how many commands run at once.
+//
+// Every running command occupies one slot. A pipeline connected by pipes
+// needs all of its stages live at the same time, otherwise a writer blocks
+// on a reader that was never started, so a pipeline is admitted as a gang:
+// it waits until it can take one slot per stage and then starts them all.
+// A gang larger than the limit is clamped to the limit, which means an
+// over-long pipeline runs alone instead of never running.
+//
+// Commands nested inside a running stage (an inner pipeline, tee branches)
+// reuse the slot of the stage that started them and claim the rest without
+// waiting. Their parent is already live and cannot finish until they do,
+// so making them wait could deadlock the whole tree; the extra slots still
+// count against the limit, so new top-level work is held back until usage
+// drops below it again.
+//
+// Fan-in sources (Concat, Interleave) do not need each other, so they are
+// bounded instead: the fan-in's own slot runs them one after another, and
+// every further source that runs alongside waits for a slot of its own.
+// Those waits go ahead of queued pipelines, since the tree they belong to
+// already holds slots and is waiting for them.
+type Scheduler struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	waiters list.List // of *schedWaiter, in arrival order
+}
+
+type schedWaiter struct {
+	n      int
+	nested bool // a fan-in source, admitted before any gang
+	ready  chan struct{}
+}
+
+// NewScheduler creates a scheduler that runs at most maxProcs commands at
+// once. A maxProcs of zero or less means no limit.
+func NewScheduler(maxProcs int) *Scheduler {
+	return &Scheduler{limit: maxProcs}
+}
+
+// Limit returns the maximum number of concurrent commands (0 for unlimited)
+func (s *Scheduler) Limit() int {
+	return s.limit
+}
+
+// Running returns the number of slots currently in use
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Acquire reserves n slots and returns the context the admitted commands
+// should run with, plus a function that gives the slots back. If ctx already
+// belongs to a command admitted by s, the call is treated as nested and
+// never blocks; otherwise it waits in arrival order until the slots are
+// free or ctx is done.
+func (s *Scheduler) Acquire(ctx context.Context, n int) (context.Context, func(), error) {
+	if n < 1 {
+		n = 1
+	}
+
+	if held, _ := ctx.Value(schedGrantKey{}).(*Scheduler); held == s {
+		// The caller's own slot covers one of the commands
+		extra := n - 1
+		s.mu.Lock()
+		s.running += extra
+		s.mu.Unlock()
+		return ctx, s.releaseFunc(extra), nil
+	}
+
+	if s.limit > 0 && n > s.limit {
+		n = s.limit
+	}
+
+	s.mu.Lock()
+	if s.waiters.Len() == 0 && s.fits(n) {
+		s.running += n
+		s.mu.Unlock()
+		return context.WithValue(ctx, schedGrantKey{}, s), s.releaseFunc(n), nil
+	}
+
+	w := &schedWaiter{n: n, ready: make(chan struct{})}
+	s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	if err := s.wait(ctx, w); err != nil {
+		return ctx, func() {}, err
+	}
+	return context.WithValue(ctx, schedGrantKey{}, s), s.releaseFunc(n), nil
+}
+
+// acquireSource reserves one slot for a fan-in source started inside a
+// command admitted by s, waiting until it is free or ctx is done
+func (s *Scheduler) acquireSource(ctx context.Context) (func(), error) {
+	s.mu.Lock()
+	if s.fits(1) {
+		s.running++
+		s.mu.Unlock()
+		return s.releaseFunc(1), nil
+	}
+
+	w := &schedWaiter{n: 1, nested: true, ready: make(chan struct{})}
+	s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	if err := s.wait(ctx, w); err != nil {
+		return nil, err
+	}
+	return s.releaseFunc(1), nil
+}
+
+// wait blocks until w is admitted or ctx is done, in which case w leaves
+// the queue
+func (s *Scheduler) wait(ctx context.Context, w *schedWaiter) error {
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// Granted while we were giving up; hand the slots back
+			s.running -= w.n
+		default:
+			for e := s.waiters.Front(); e != nil; e = e.Next() {
+				if e.Value == w {
+					s.waiters.Remove(e)
+					break
+				}
+			}
+		}
+		// Either way the next waiter may now fit
+		s.wakeLocked()
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// fits reports whether n more slots can be granted; callers hold s.mu
+func (s *Scheduler) fits(n int) bool {
+	return s.limit <= 0 || s.running == 0 || s.running+n <= s.limit
+}
+
+// wakeLocked admits queued fan-in sources while slots are free, then
+// queued gangs in order while they fit; callers hold s.mu
+func (s *Scheduler) wakeLocked() {
+	for e := s.waiters.Front(); e != nil; {
+		next := e.Next()
+		if w := e.Value.(*schedWaiter); w.nested && s.fits(w.n) {
+			s.admitLocked(e)
+		}
+		e = next
+	}
+	for e := s.waiters.Front(); e != nil; e = s.waiters.Front() {
+		if !s.fits(e.Value.(*schedWaiter).n) {
+			return
+		}
+		s.admitLocked(e)
+	}
+}
+
+// admitLocked grants a queued waiter its slots; callers hold s.mu
+func (s *Scheduler) admitLocked(e *list.Element) {
+	w := e.Value.(*schedWaiter)
+	s.running += w.n
+	s.waiters.Remove(e)
+	close(w.ready)
+}
+
+func (s *Scheduler) releaseFunc(n int) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if n == 0 {
+				return
+			}
+			s.mu.Lock()
+			s.running -= n
+			s.wakeLocked()
+			s.mu.Unlock()
+		})
+	}
+}
+
+type schedulerKey struct{}
+
+// schedGrantKey marks a context as belonging to an admitted command
+type schedGrantKey struct{}
+
+// WithScheduler returns a context whose pipelines share s. Use it to bound
+// concurrency across many pipelines executing at the same time.
+func WithScheduler(ctx context.Context, s *Scheduler) context.Context {
+	return context.WithValue(ctx, schedulerKey{}, s)
+}
+
+// SchedulerFrom returns the scheduler attached to ctx, or nil
+func SchedulerFrom(ctx context.Context) *Scheduler {
+	s, _ := ctx.Value(schedulerKey{}).(*Scheduler)
+	return s
+}
+
+// acquireFanOut admits n commands that must run alongside each other, if
+// ctx carries a scheduler
+func acquireFanOut(ctx context.Context, n int) (context.Context, func(), error) {
+	sched := SchedulerFrom(ctx)
+	if sched == nil {
+		return ctx, func() {}, nil
+	}
+	return sched.Acquire(ctx, n)
+}
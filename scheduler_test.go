@@ -0,0 +1,191 @@
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	yup "github.com/yupsh/framework"
+)
+
+// cmdFunc adapts a function to the Command interface
+type cmdFunc func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error
+
+func (f cmdFunc) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	return f(ctx, stdin, stdout, stderr)
+}
+
+// passthrough copies stdin to stdout
+var passthrough = cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	_, err := io.Copy(stdout, stdin)
+	return err
+})
+
+func TestScheduler(t *testing.T) {
+	t.Run("limits concurrent pipelines", func(t *testing.T) {
+		sched := yup.NewScheduler(2)
+		ctx := yup.WithScheduler(context.Background(), sched)
+
+		var live, peak atomic.Int32
+		track := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			n := live.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			live.Add(-1)
+			return nil
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = yup.Pipe(track).Execute(ctx, strings.NewReader("data\n"), io.Discard, io.Discard)
+			}()
+		}
+		wg.Wait()
+
+		if got := peak.Load(); got > 2 {
+			t.Errorf("Expected at most 2 commands at once, saw %d", got)
+		}
+		if got := sched.Running(); got != 0 {
+			t.Errorf("Expected all slots released, %d still in use", got)
+		}
+	})
+
+	t.Run("long pipeline runs alone", func(t *testing.T) {
+		ctx := yup.WithScheduler(context.Background(), yup.NewScheduler(1))
+		done := make(chan error, 1)
+		go func() {
+			done <- yup.Pipe(passthrough, passthrough, passthrough).Execute(ctx, strings.NewReader("data\n"), io.Discard, io.Discard)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Pipeline longer than the limit never ran")
+		}
+	})
+
+	t.Run("nested pipelines do not deadlock", func(t *testing.T) {
+		ctx := yup.WithScheduler(context.Background(), yup.NewScheduler(2))
+		nested := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			return yup.Pipe(passthrough, passthrough).Execute(ctx, stdin, stdout, stderr)
+		})
+
+		done := make(chan error, 1)
+		go func() {
+			done <- yup.Pipe(nested, nested).Execute(ctx, strings.NewReader("data\n"), io.Discard, io.Discard)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Nested pipeline deadlocked")
+		}
+	})
+
+	t.Run("cancelled while waiting", func(t *testing.T) {
+		sched := yup.NewScheduler(1)
+		_, release, err := sched.Acquire(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, _, err = sched.Acquire(ctx, 1)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+		if got := sched.Running(); got != 1 {
+			t.Errorf("Expected 1 slot in use, got %d", got)
+		}
+	})
+}
+
+func TestMaxProcs(t *testing.T) {
+	var live, peak atomic.Int32
+	source := func(i int) yup.Command {
+		return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			n := live.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			live.Add(-1)
+			_, err := fmt.Fprintln(stdout, i)
+			return err
+		})
+	}
+
+	for _, tt := range []struct {
+		name  string
+		merge func(...yup.Command) yup.Command
+	}{
+		{"concat", yup.Concat},
+		{"interleave", yup.Interleave},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			live.Store(0)
+			peak.Store(0)
+			var sources []yup.Command
+			var want []string
+			for i := 0; i < 20; i++ {
+				sources = append(sources, source(i))
+				want = append(want, fmt.Sprint(i))
+			}
+
+			var output strings.Builder
+			err := yup.Pipe(tt.merge(sources...), passthrough).WithFlags(yup.MaxProcs(3)).
+				Execute(context.Background(), nil, &output, io.Discard)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// The pipeline's two stages hold two slots, leaving one spare
+			if got := peak.Load(); got > 2 {
+				t.Errorf("Expected at most 2 sources at once, saw %d", got)
+			}
+			got := strings.Fields(output.String())
+			if tt.name == "interleave" {
+				sort.Strings(got)
+				sort.Strings(want)
+			}
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("Got output %q", output.String())
+			}
+		})
+	}
+
+	t.Run("one slot", func(t *testing.T) {
+		var output strings.Builder
+		err := yup.Pipe(yup.Interleave(source(1), source(2))).WithFlags(yup.MaxProcs(1)).
+			Execute(context.Background(), nil, &output, io.Discard)
+		if err != nil || len(strings.Fields(output.String())) != 2 {
+			t.Errorf("Got %q, err %v", output.String(), err)
+		}
+	})
+}
@@ -0,0 +1,703 @@
+package yup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// DefaultHistorySize is how many lines of history a Shell keeps by default
+const DefaultHistorySize = 1000
+
+// Shell is the interactive yupsh: it reads command lines, parses them
+// against a Registry and runs them. On a terminal it edits lines itself,
+// with history and completion of command names and file paths. A line
+// ending in & runs as a background job, managed with the jobs, fg, wait and
+// kill builtins. Ctrl-C cancels the foreground command's context.
+type Shell struct {
+	Registry *Registry
+
+	// Env is the environment commands run in, changed by the cd, export
+	// and unset builtins and by NAME=value assignments. Each change
+	// replaces it with a modified clone, so running jobs keep the Env they
+	// started with. Commands look it up when they start, so later commands
+	// of a line see the changes of earlier ones.
+	Env *Env
+
+	// Prompt returns the prompt shown before each line, "$ " if nil
+	Prompt func() string
+
+	// HistoryFile keeps history between sessions when set
+	HistoryFile string
+	HistorySize int // Lines kept; DefaultHistorySize if zero
+
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+
+	envMu   sync.Mutex // guards Env while a line runs
+	jobs    *JobTable
+	history []string
+	status  int
+	exiting bool
+}
+
+// NewShell creates a shell for the commands in registry on the process's
+// standard streams
+func NewShell(registry *Registry) *Shell {
+	return &Shell{
+		Registry: registry,
+		Env:      ProcessEnv(),
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		jobs:     NewJobTable(),
+	}
+}
+
+// Status returns the exit status of the last command line
+func (s *Shell) Status() int {
+	return s.status
+}
+
+// Jobs returns the shell's background jobs
+func (s *Shell) Jobs() *JobTable {
+	return s.jobs
+}
+
+// History returns the command lines entered so far, oldest first
+func (s *Shell) History() []string {
+	return s.history
+}
+
+// Run reads and executes command lines until end of input or the exit
+// builtin, then cancels any jobs still running and returns the last status
+func (s *Shell) Run(ctx context.Context) int {
+	s.loadHistory()
+	defer s.stopJobs()
+
+	read := s.lineReader()
+lines:
+	for !s.exiting && ctx.Err() == nil {
+		s.jobs.Notify(s.Stderr)
+
+		line, err := read(s.prompt())
+		if errors.Is(err, ErrInterrupted) {
+			s.status = StatusCanceled
+			continue
+		}
+		if err != nil {
+			break
+		}
+
+		// Keep reading while the line is unfinished, e.g. inside quotes
+		cmd, background, err := s.parse(ctx, line)
+		for isIncomplete(err) {
+			more, readErr := read("> ")
+			if errors.Is(readErr, ErrInterrupted) {
+				s.status = StatusCanceled
+				continue lines
+			}
+			if readErr != nil {
+				break
+			}
+			line += "\n" + more
+			cmd, background, err = s.parse(ctx, line)
+		}
+
+		s.addHistory(line)
+		s.execute(ctx, cmd, background, err)
+	}
+	return s.status
+}
+
+// Exec runs one command line, as if typed at the prompt, and returns its
+// status
+func (s *Shell) Exec(ctx context.Context, line string) int {
+	cmd, background, err := s.parse(ctx, line)
+	s.execute(ctx, cmd, background, err)
+	return s.status
+}
+
+// parse parses a command line, recognising a trailing & as a request to
+// run it in the background
+func (s *Shell) parse(ctx context.Context, line string) (Command, bool, error) {
+	if strings.TrimSpace(line) == "" {
+		return nil, false, nil
+	}
+	cmd, err := Parse(ctx, line, s)
+
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) {
+		head := strings.TrimRight(line, " \t\n")
+		if syntaxErr.Offset == len(head)-1 && strings.HasSuffix(head, "&") {
+			cmd, err = Parse(ctx, head[:len(head)-1], s)
+			return cmd, true, err
+		}
+	}
+	return cmd, false, err
+}
+
+// execute runs a parsed command line and records its status
+func (s *Shell) execute(ctx context.Context, cmd Command, background bool, err error) {
+	switch {
+	case err != nil:
+		_, _ = fmt.Fprintf(s.Stderr, "yupsh: %v\n", err)
+		s.status = ExitStatus(err)
+	case cmd == nil:
+	case background:
+		p, ok := cmd.(*Pipeline)
+		if !ok {
+			p = Pipe(cmd)
+		}
+		// A job keeps the Env it started with
+		job := s.jobs.Start(s.context(ctx), p, strings.NewReader(""), s.Stdout, s.Stderr)
+		_, _ = fmt.Fprintf(s.Stderr, "[%d]\n", job.ID)
+		s.status = StatusSuccess
+	default:
+		s.status = s.foreground(withLiveEnv(ctx, s), func(ctx context.Context) error {
+			return cmd.Execute(ctx, s.Stdin, s.Stdout, s.Stderr)
+		})
+	}
+}
+
+// foreground runs fn with a context that Ctrl-C cancels, as the job that
+// owns the terminal
+func (s *Shell) foreground(ctx context.Context, fn func(context.Context) error) int {
+	ctx, cancel := context.WithCancel(withForeground(ctx))
+	defer cancel()
+
+	var interrupted atomic.Bool
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			interrupted.Store(true)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := fn(ctx)
+	if interrupted.Load() {
+		_, _ = fmt.Fprintln(s.Stderr)
+		return StatusCanceled
+	}
+	return ExitStatus(err)
+}
+
+// lineReader returns the function reading command lines: the line editor
+// on a terminal, plain reads otherwise
+func (s *Shell) lineReader() func(prompt string) (string, error) {
+	if file, ok := s.Stdin.(*os.File); ok && isTerminal(file.Fd()) {
+		editor := NewLineEditor(file, s.Stdout)
+		editor.Complete = s.Complete
+		return func(prompt string) (string, error) {
+			restore, err := makeRaw(file.Fd())
+			if err != nil {
+				return "", err
+			}
+			defer func() { _ = restore() }()
+			editor.History = s.history
+			line, err := editor.ReadLine(prompt)
+			if err == io.EOF {
+				_, _ = fmt.Fprintln(s.Stdout, "exit")
+			}
+			return line, err
+		}
+	}
+
+	reader := bufio.NewReader(s.Stdin)
+	return func(string) (string, error) {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimSuffix(line, "\n"), err
+	}
+}
+
+// context attaches the shell's Env, if any, to ctx
+func (s *Shell) context(ctx context.Context) context.Context {
+	env := s.env()
+	if env == nil {
+		return ctx
+	}
+	return WithEnv(ctx, env)
+}
+
+// env returns the shell's Env as it is now
+func (s *Shell) env() *Env {
+	s.envMu.Lock()
+	defer s.envMu.Unlock()
+	return s.Env
+}
+
+// setEnv replaces the shell's Env
+func (s *Shell) setEnv(env *Env) {
+	s.envMu.Lock()
+	defer s.envMu.Unlock()
+	s.Env = env
+}
+
+func (s *Shell) prompt() string {
+	if s.Prompt == nil {
+		return "$ "
+	}
+	return s.Prompt()
+}
+
+// stopJobs cancels background jobs and waits for them to finish
+func (s *Shell) stopJobs() {
+	for _, job := range s.jobs.Jobs() {
+		job.Cancel()
+	}
+	s.jobs.WaitAll()
+}
+
+// isIncomplete reports whether err means the input ended too early
+func isIncomplete(err error) bool {
+	var syntaxErr *SyntaxError
+	return errors.As(err, &syntaxErr) && syntaxErr.incomplete
+}
+
+// Resolve finds builtins first and then registered commands, making the
+// shell the Resolver for the lines it parses
+func (s *Shell) Resolve(name string) (Constructor, bool) {
+	if fn, ok := shellBuiltins[name]; ok {
+		return func(parameters ...any) Command {
+			b := &builtin{shell: s, name: name, fn: fn}
+			for _, p := range parameters {
+				b.args = append(b.args, fmt.Sprint(p))
+			}
+			return b
+		}, true
+	}
+	if s.Registry == nil {
+		return nil, false
+	}
+	ctor, ok := s.Registry.Resolve(name)
+	if !ok {
+		return nil, false
+	}
+	return func(parameters ...any) Command {
+		cmd := ctor(parameters...)
+		switch cmd.(type) {
+		case *Pipeline, *commandList:
+			// Their commands look the Env up as each starts
+			return cmd
+		}
+		return shellCommand{cmd}
+	}, true
+}
+
+// shellCommand runs a registered command in the shell's Env as it is when
+// the command starts
+type shellCommand struct {
+	cmd Command
+}
+
+func (c shellCommand) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	return c.cmd.Execute(startEnv(ctx), stdin, stdout, stderr)
+}
+
+func (c shellCommand) Describe() string {
+	return Describe(c.cmd)
+}
+
+// Complete offers completions for the word before the cursor: command
+// names in command position, file paths elsewhere
+func (s *Shell) Complete(head string) (string, []string) {
+	start := len(head)
+	for start > 0 && (!strings.ContainsRune(" \t|;&<>(", rune(head[start-1])) ||
+		start > 1 && head[start-2] == '\\') {
+		start--
+	}
+	word := head[start:]
+
+	before := strings.TrimRight(head[:start], " \t")
+	if before == "" || strings.ContainsRune("|;&({", rune(before[len(before)-1])) {
+		return word, s.completeCommand(word)
+	}
+	return word, completePath(s.context(context.Background()), word)
+}
+
+func (s *Shell) completeCommand(prefix string) []string {
+	var names []string
+	for name := range shellBuiltins {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	if s.Registry != nil {
+		names = append(names, s.Registry.Names(prefix)...)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completePath lists the paths that word could be the start of, with
+// characters special to the shell escaped
+func completePath(ctx context.Context, word string) []string {
+	unescaped := strings.ReplaceAll(word, `\`, "")
+	dir, base := filepath.Split(unescaped)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := ReadDir(ctx, readDir)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		path := escapeWord(dir + name)
+		if isDir(ctx, readDir, entry) {
+			path += "/"
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// isDir reports whether entry is a directory or a symlink to one
+func isDir(ctx context.Context, dir string, entry fs.DirEntry) bool {
+	if entry.IsDir() {
+		return true
+	}
+	if entry.Type()&fs.ModeSymlink == 0 {
+		return false
+	}
+	info, err := Stat(ctx, filepath.Join(dir, entry.Name()))
+	return err == nil && info.IsDir()
+}
+
+// escapeWord backslash-escapes characters that would split or change a word
+func escapeWord(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if !isShellSafe(r) && r != '~' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// loadHistory reads HistoryFile, if any
+func (s *Shell) loadHistory() {
+	if s.HistoryFile == "" {
+		return
+	}
+	data, err := os.ReadFile(s.HistoryFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line != "" {
+			s.history = append(s.history, line)
+		}
+	}
+	s.trimHistory()
+}
+
+// addHistory records a line, skipping blanks and immediate repeats, and
+// appends it to HistoryFile
+func (s *Shell) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(s.history) > 0 && s.history[len(s.history)-1] == line) {
+		return
+	}
+	s.history = append(s.history, line)
+	s.trimHistory()
+
+	if s.HistoryFile == "" || strings.Contains(line, "\n") {
+		return
+	}
+	f, err := os.OpenFile(s.HistoryFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return
+	}
+	_, _ = fmt.Fprintln(f, line)
+	_ = f.Close()
+}
+
+func (s *Shell) trimHistory() {
+	size := s.HistorySize
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	if len(s.history) > size {
+		s.history = s.history[len(s.history)-size:]
+	}
+}
+
+// builtin is a command implemented by the shell itself
+type builtin struct {
+	shell *Shell
+	name  string
+	args  []string
+	fn    builtinFunc
+}
+
+type builtinFunc func(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error
+
+func (b *builtin) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	return b.fn(startEnv(ctx), b.shell, b.args, stdout, stderr)
+}
+
+func (b *builtin) Describe() string {
+	words := []string{b.name}
+	for _, arg := range b.args {
+		words = append(words, QuoteWord(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// shellBuiltins are the commands that need the shell's own state
+var shellBuiltins map[string]builtinFunc
+
+func init() {
+	shellBuiltins = map[string]builtinFunc{
+		"cd":      builtinCd,
+		"exit":    builtinExit,
+		"export":  builtinExport,
+		"fg":      builtinFg,
+		"help":    builtinHelp,
+		"history": builtinHistory,
+		"jobs":    builtinJobs,
+		"kill":    builtinKill,
+		"pwd":     builtinPwd,
+		"unset":   builtinUnset,
+		"wait":    builtinWait,
+	}
+}
+
+func builtinCd(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	if len(args) > 1 {
+		ErrorF(stderr, "cd", "", errors.New("too many arguments"))
+		return Exit(StatusFailure)
+	}
+	dir := Getenv(ctx, "HOME")
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	current := s.env()
+	if current == nil {
+		return chdir(stderr, dir, os.Chdir(dir))
+	}
+
+	info, err := Stat(ctx, dir)
+	if err == nil && !info.IsDir() {
+		err = syscall.ENOTDIR
+	}
+	if err != nil {
+		return chdir(stderr, dir, err)
+	}
+	path := filepath.Clean(current.Path(dir))
+	env := current.Clone()
+	env.Dir = path
+	env.Vars["OLDPWD"], env.Vars["PWD"] = current.Dir, path
+	s.setEnv(env)
+	return nil
+}
+
+// chdir reports a failed cd
+func chdir(stderr io.Writer, dir string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	ErrorF(stderr, "cd", dir, err)
+	return ExitWithError(StatusFailure, err)
+}
+
+func builtinPwd(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	_, _ = fmt.Fprintln(stdout, Getwd(ctx))
+	return nil
+}
+
+// builtinExport moves shell variables into the environment, optionally
+// assigning them, or with no arguments lists the environment
+func builtinExport(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	current := s.env()
+	if current == nil {
+		ErrorF(stderr, "export", "", errors.New("no shell environment"))
+		return Exit(StatusFailure)
+	}
+	if len(args) == 0 {
+		for _, kv := range current.Environ() {
+			name, value, _ := strings.Cut(kv, "=")
+			_, _ = fmt.Fprintf(stdout, "export %s=%s\n", name, QuoteWord(value))
+		}
+		return nil
+	}
+
+	env := current.Clone()
+	var last error
+	for _, arg := range args {
+		name, value, assign := strings.Cut(arg, "=")
+		if !isVarName(name) {
+			ErrorF(stderr, "export", arg, errors.New("not a valid identifier"))
+			last = Exit(StatusFailure)
+			continue
+		}
+		if !assign {
+			value, assign = env.Locals[name]
+		}
+		delete(env.Locals, name)
+		if assign {
+			env.Vars[name] = value
+		}
+	}
+	s.setEnv(env)
+	return last
+}
+
+func builtinUnset(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	current := s.env()
+	if current == nil {
+		ErrorF(stderr, "unset", "", errors.New("no shell environment"))
+		return Exit(StatusFailure)
+	}
+	env := current.Clone()
+	for _, name := range args {
+		delete(env.Locals, name)
+		delete(env.Vars, name)
+	}
+	s.setEnv(env)
+	return nil
+}
+
+func builtinExit(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	s.exiting = true
+	if len(args) == 0 {
+		return Exit(s.status)
+	}
+	status, err := strconv.Atoi(args[0])
+	if err != nil {
+		ErrorF(stderr, "exit", args[0], errors.New("numeric argument required"))
+		return Exit(StatusUsage)
+	}
+	return Exit(status & 0xff)
+}
+
+func builtinFg(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	spec := "%%"
+	if len(args) > 0 {
+		spec = args[0]
+	}
+	job, err := s.jobs.Lookup(spec)
+	if err != nil {
+		ErrorF(stderr, "fg", "", err)
+		return ExitWithError(StatusFailure, err)
+	}
+	_, _ = fmt.Fprintln(stdout, job.Describe())
+
+	select {
+	case <-job.Done():
+	case <-ctx.Done():
+		job.Cancel()
+	}
+	_, err = job.Wait()
+	s.jobs.remove(job.ID)
+	return err
+}
+
+func builtinHelp(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	for _, name := range args {
+		if _, ok := shellBuiltins[name]; ok {
+			_, _ = fmt.Fprintf(stdout, "%s: shell builtin\n", name)
+			continue
+		}
+		spec, ok := Spec{}, false
+		if s.Registry != nil {
+			spec, ok = s.Registry.Lookup(name)
+		}
+		if !ok {
+			ErrorF(stderr, "help", "", fmt.Errorf("no help topics match '%s'", name))
+			return Exit(StatusFailure)
+		}
+		spec.Usage(stdout)
+	}
+	if len(args) > 0 {
+		return nil
+	}
+
+	var builtins []string
+	for name := range shellBuiltins {
+		builtins = append(builtins, name)
+	}
+	sort.Strings(builtins)
+	_, _ = fmt.Fprintf(stdout, "Builtins: %s\n", strings.Join(builtins, " "))
+	if s.Registry != nil {
+		_, _ = fmt.Fprintln(stdout, "Commands:")
+		for _, spec := range s.Registry.Specs() {
+			_, _ = fmt.Fprintln(stdout, strings.TrimRight(fmt.Sprintf("  %-12s %s", spec.Name, spec.Synopsis), " "))
+		}
+	}
+	return nil
+}
+
+func builtinHistory(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	for i, line := range s.history {
+		_, _ = fmt.Fprintf(stdout, "%5d  %s\n", i+1, line)
+	}
+	return nil
+}
+
+func builtinJobs(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	s.jobs.List(stdout)
+	return nil
+}
+
+func builtinKill(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		ErrorF(stderr, "kill", "", errors.New("usage: kill %job ..."))
+		return Exit(StatusUsage)
+	}
+	var last error
+	for _, spec := range args {
+		if err := s.jobs.Kill(spec); err != nil {
+			ErrorF(stderr, "kill", "", errors.Unwrap(err))
+			last = err
+		}
+	}
+	return last
+}
+
+func builtinWait(ctx context.Context, s *Shell, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		s.jobs.WaitAll()
+		return nil
+	}
+	var last error
+	for _, spec := range args {
+		_, err := s.jobs.Wait(spec)
+		if ExitStatus(err) == StatusNotFound {
+			ErrorF(stderr, "wait", "", errors.Unwrap(err))
+		}
+		last = err
+	}
+	return last
+}
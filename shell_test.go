@@ -0,0 +1,276 @@
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+)
+
+// syncBuilder is a strings.Builder that background jobs can write to
+type syncBuilder struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (s *syncBuilder) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuilder) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+// testShell runs a shell over the multi-call registry plus a cat
+func testShell(input string) (*yup.Shell, *syncBuilder, *syncBuilder) {
+	registry := multiCall()
+	registry.Register(yup.Spec{Name: "cat", New: catFiles})
+	// The shell's wait builtin hides the registry's
+	registry.Register(yup.Spec{Name: "block", New: waitForCancel})
+
+	var stdout, stderr syncBuilder
+	sh := yup.NewShell(registry)
+	sh.Stdin, sh.Stdout, sh.Stderr = strings.NewReader(input), &stdout, &stderr
+	return sh, &stdout, &stderr
+}
+
+func TestShellRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantStatus int
+		wantStdout string
+		wantStderr string
+	}{
+		{"pipeline", "echo a b | cat\n", 0, "a\nb\n", ""},
+		{"last status", "fail\necho a\n", 0, "a\n", ""},
+		{"failing last line", "echo a\nfail", 3, "a\n", ""},
+		{"unknown command", "nosuch\n", yup.StatusNotFound, "", "yupsh: nosuch: command not found\n"},
+		{"syntax error", "echo a |; echo b\n", yup.StatusUsage, "", "yupsh: syntax error at column 9: unexpected \";\"\n"},
+		{"continued quote", "echo 'a\nb'\n", 0, "a\nb\n", ""},
+		{"continued pipe", "echo a |\ncat\n", 0, "a\n", ""},
+		{"exit", "echo a\nexit 4\necho b\n", 4, "a\n", ""},
+		{"exit keeps status", "fail\nexit\n", 3, "", ""},
+		{"history", "echo a\n\necho a\necho b\nhistory\n", 0, "a\na\nb\n    1  echo a\n    2  echo b\n    3  history\n", ""},
+		{"help", "help echo\n", 0, "Usage: echo\nWrite arguments to standard output.\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, stdout, stderr := testShell(tt.input)
+			if got := sh.Run(context.Background()); got != tt.wantStatus {
+				t.Errorf("Run() = %d, want %d", got, tt.wantStatus)
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestShellJobs(t *testing.T) {
+	sh, stdout, stderr := testShell("")
+	ctx := context.Background()
+
+	if got := sh.Exec(ctx, "block && echo never &"); got != 0 {
+		t.Fatalf("Exec(&) = %d", got)
+	}
+	if got := stderr.String(); got != "[1]\n" {
+		t.Errorf("stderr = %q, want %q", got, "[1]\n")
+	}
+	sh.Exec(ctx, "jobs")
+	if want := "[1]+  Running   "; !strings.Contains(stdout.String(), want) {
+		t.Errorf("jobs = %q, want %q", stdout.String(), want)
+	}
+
+	if got := sh.Exec(ctx, "kill %1"); got != 0 {
+		t.Errorf("kill = %d", got)
+	}
+	if got := sh.Exec(ctx, "wait %1"); got != yup.StatusCanceled {
+		t.Errorf("wait = %d, want %d", got, yup.StatusCanceled)
+	}
+	if got := sh.Exec(ctx, "fg"); got != yup.StatusFailure {
+		t.Errorf("fg without jobs = %d, want %d", got, yup.StatusFailure)
+	}
+	if !strings.HasSuffix(stderr.String(), "fg: %%: no current job\n") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+
+	sh.Exec(ctx, "echo done &")
+	if got := sh.Exec(ctx, "fg %1"); got != 0 {
+		t.Errorf("fg = %d", got)
+	}
+	if len(sh.Jobs().Jobs()) != 0 {
+		t.Errorf("jobs left after fg: %d", len(sh.Jobs().Jobs()))
+	}
+}
+
+func TestShellCd(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	sh, stdout, stderr := testShell("")
+	if got := sh.Exec(context.Background(), "cd sub"); got != 0 {
+		t.Fatalf("cd = %d: %s", got, stderr)
+	}
+	sh.Exec(context.Background(), "pwd")
+	if got := strings.TrimSpace(stdout.String()); filepath.Base(got) != "sub" {
+		t.Errorf("pwd = %s", got)
+	}
+	if wd, _ := os.Getwd(); filepath.Base(wd) == "sub" {
+		t.Errorf("cd changed the process working directory")
+	}
+
+	// Later commands of a line run in the directory cd left
+	stdout.b.Reset()
+	if got := sh.Exec(context.Background(), "cd .. && pwd; cd sub"); got != 0 {
+		t.Fatalf("cd .. && pwd = %d: %s", got, stderr)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != dir {
+		t.Errorf("pwd after cd .. = %s, want %s", got, dir)
+	}
+	if got := sh.Exec(context.Background(), "cd nosuch"); got != 1 {
+		t.Errorf("cd nosuch = %d", got)
+	}
+	if want := "cd: nosuch: no such file or directory\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestShellEnv(t *testing.T) {
+	sh, stdout, stderr := testShell("")
+	sh.Env = &yup.Env{Vars: map[string]string{"A": "1"}, Locals: map[string]string{"B": "2"}}
+	ctx := context.Background()
+
+	sh.Exec(ctx, "export C=3 B")
+	sh.Exec(ctx, "unset A")
+	sh.Exec(ctx, "echo $A$B$C")
+	sh.Exec(ctx, "export")
+	sh.Exec(ctx, "export D=4 && echo $D")
+	sh.Exec(ctx, "E=5 C=6; echo $E$C")
+	sh.Exec(ctx, "export")
+	if want := "23\nexport B=2\nexport C=3\n4\n56\nexport B=2\nexport C=6\nexport D=4\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+	if got := sh.Exec(ctx, "export 1x"); got != 1 || stderr.String() != "export: 1x: not a valid identifier\n" {
+		t.Errorf("export 1x = %d, %q", got, stderr.String())
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"notes.txt", "notes.md", "my file", ".hidden", "src/main.go"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	sh, _, _ := testShell("")
+	tests := []struct {
+		head     string
+		wantWord string
+		want     []string
+	}{
+		{"e", "e", []string{"echo", "exit", "export"}},
+		{"cat a | se", "se", []string{"search"}},
+		{"cat no", "no", []string{"notes.md", "notes.txt"}},
+		{"cat ", "", []string{`my\ file`, "notes.md", "notes.txt", "src/"}},
+		{`cat my\ f`, `my\ f`, []string{`my\ file`}},
+		{"cat .h", ".h", []string{".hidden"}},
+		{"cat <src/m", "src/m", []string{"src/main.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.head, func(t *testing.T) {
+			word, got := sh.Complete(tt.head)
+			if word != tt.wantWord || !slices.Equal(got, tt.want) {
+				t.Errorf("Complete() = %q, %q, want %q, %q", word, got, tt.wantWord, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		want    string
+		wantErr error
+	}{
+		{"typing", "echo hi\r", "echo hi", nil},
+		{"arrows", "ac\x1b[Db\r", "abc", nil},
+		{"home and end", "bc\x01a\x05d\r", "abcd", nil},
+		{"backspace and delete", "abxc\x7f\x7f\x7fbc\x01\x1b[3~\r", "bc", nil},
+		{"kill to end", "abc\x02\x02\x0b\r", "a", nil},
+		{"kill to start", "abc\x02\x15\r", "c", nil},
+		{"delete word", "cat a.txt\x17b\r", "cat b", nil},
+		{"history", "\x1b[A\x1b[A\r", "first", nil},
+		{"history and back", "new\x1b[A\x1b[B\r", "new", nil},
+		{"complete", "cat no\t\r", "cat notes.", nil},
+		{"complete unique", "ca\tx\r", "cat x", nil},
+		{"complete by rune", "cat na\t\r", "cat na", nil},
+		{"interrupt", "abc\x03", "", yup.ErrInterrupted},
+		{"end of input", "\x04", "", io.EOF},
+		{"ctrl-d deletes", "ab\x01\x04\r", "b", nil},
+		{"unterminated line", "abc", "abc", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := yup.NewLineEditor(strings.NewReader(tt.keys), io.Discard)
+			e.History = []string{"first", "second"}
+			e.Complete = func(head string) (string, []string) {
+				fields := strings.Fields(head)
+				word := fields[len(fields)-1]
+				var out []string
+				for _, c := range []string{"cat", "notes.md", "notes.txt", "naïve", "naîve"} {
+					if strings.HasPrefix(c, word) {
+						out = append(out, c)
+					}
+				}
+				return word, out
+			}
+
+			got, err := e.ReadLine("$ ")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadLine() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatchShell(t *testing.T) {
+	var stdout, stderr strings.Builder
+	registry := multiCall()
+	if got := yup.Dispatch(context.Background(), registry, []string{"yup", "yupsh", "-c", "echo a b | search x"}, strings.NewReader(""), &stdout, &stderr); got != 0 {
+		t.Errorf("Dispatch(yupsh -c) = %d: %s", got, stderr.String())
+	}
+
+	stdout.Reset()
+	got := yup.Dispatch(context.Background(), registry, []string{"/bin/yupsh"}, strings.NewReader("echo hi\nfail\n"), &stdout, &stderr)
+	if got != 3 || stdout.String() != "hi\n" {
+		t.Errorf("Dispatch(yupsh) = %d, %q", got, stdout.String())
+	}
+}
@@ -0,0 +1,129 @@
+package yup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Conventional exit statuses
+const (
+	StatusSuccess       = 0
+	StatusFailure       = 1   // Generic failure
+	StatusUsage         = 2   // Misuse, e.g. bad arguments or trouble (grep)
+	StatusTimeout       = 124 // Deadline exceeded, as reported by timeout(1)
+	StatusCannotExecute = 126 // Command found but could not be run
+	StatusNotFound      = 127 // No such command or job
+	StatusCanceled      = 130 // Interrupted, as after SIGINT
+	StatusBrokenPipe    = 141 // Killed by SIGPIPE
+)
+
+// ErrBrokenPipe is returned by writes to a pipeline stage whose reader has
+// already returned, the equivalent of SIGPIPE. Inside a pipeline it means
+// the downstream stage had all the input it wanted, so the writing stage is
+// considered to have terminated cleanly.
+var ErrBrokenPipe = errors.New("broken pipe")
+
+// ExitError carries a command's numeric exit status. Commands return it to
+// distinguish outcomes such as "no match" (1) from "failed" (2).
+type ExitError struct {
+	Status int
+	Err    error // Underlying cause, may be nil
+}
+
+// Exit returns an error reporting status, or nil for status 0
+func Exit(status int) error {
+	if status == StatusSuccess {
+		return nil
+	}
+	return &ExitError{Status: status}
+}
+
+// ExitWithError wraps err with an explicit exit status
+func ExitWithError(status int, err error) error {
+	return &ExitError{Status: status, Err: err}
+}
+
+func (e *ExitError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("exit status %d", e.Status)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitStatus maps an error returned by a command to its exit status: 0 for
+// nil, the carried status for an ExitError, 124/130 for an expired or
+// cancelled context, 141 for ErrBrokenPipe, and 1 for any other error
+func ExitStatus(err error) int {
+	if err == nil {
+		return StatusSuccess
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Status
+	}
+	if errors.Is(err, ErrBrokenPipe) {
+		return StatusBrokenPipe
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return StatusTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return StatusCanceled
+	}
+	return StatusFailure
+}
+
+// StageResult is the outcome of one pipeline stage
+type StageResult struct {
+	Status int
+	Err    error
+}
+
+// failed reports whether the stage counts as a failure under PipeFail. A
+// broken pipe does not: the reader had all it wanted.
+func (s StageResult) failed() bool {
+	return s.Status != StatusSuccess && s.Status != StatusBrokenPipe
+}
+
+// Result reports the outcome of every stage of a pipeline run
+type Result struct {
+	Stages   []StageResult
+	PipeFail bool
+}
+
+// PipeStatus returns each stage's exit status, like bash's PIPESTATUS
+func (r *Result) PipeStatus() []int {
+	statuses := make([]int, len(r.Stages))
+	for i, stage := range r.Stages {
+		statuses[i] = stage.Status
+	}
+	return statuses
+}
+
+// Err returns the pipeline's error following shell rules: the last stage's
+// error, or with PipeFail the error of the rightmost stage that failed
+// other than by a broken pipe
+func (r *Result) Err() error {
+	if len(r.Stages) == 0 {
+		return nil
+	}
+	if r.PipeFail {
+		for i := len(r.Stages) - 1; i >= 0; i-- {
+			if r.Stages[i].failed() {
+				return r.Stages[i].Err
+			}
+		}
+		return nil
+	}
+	return r.Stages[len(r.Stages)-1].Err
+}
+
+// Status returns the pipeline's exit status, the status of Err
+func (r *Result) Status() int {
+	return ExitStatus(r.Err())
+}
@@ -0,0 +1,75 @@
+package yup_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+)
+
+// exitWith drains stdin and exits with status
+func exitWith(status int) yup.Command {
+	return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		_, _ = io.Copy(stdout, stdin)
+		return yup.Exit(status)
+	})
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, 0},
+		{"exit error", yup.Exit(2), 2},
+		{"wrapped exit error", fmt.Errorf("grep: %w", yup.ExitWithError(1, errors.New("no match"))), 1},
+		{"plain error", errors.New("boom"), 1},
+		{"cancelled", context.Canceled, 130},
+		{"deadline", context.DeadlineExceeded, 124},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := yup.ExitStatus(tt.err); got != tt.want {
+				t.Errorf("ExitStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelineStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		commands   []yup.Command
+		pipeFail   bool
+		wantStatus []int
+		want       int
+	}{
+		{"last stage decides", []yup.Command{exitWith(2), exitWith(0)}, false, []int{2, 0}, 0},
+		{"last stage failure is reported", []yup.Command{exitWith(0), exitWith(1)}, false, []int{0, 1}, 1},
+		{"pipefail takes rightmost failure", []yup.Command{exitWith(2), exitWith(3), exitWith(0)}, true, []int{2, 3, 0}, 3},
+		{"pipefail success", []yup.Command{exitWith(0), exitWith(0)}, true, []int{0, 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := yup.Pipe(tt.commands...).
+				WithFlags(yup.PipeFailFlag(tt.pipeFail)).
+				Run(context.Background(), strings.NewReader("x\n"), io.Discard, io.Discard)
+
+			if got := result.PipeStatus(); !reflect.DeepEqual(got, tt.wantStatus) {
+				t.Errorf("PipeStatus() = %v, want %v", got, tt.wantStatus)
+			}
+			if got := yup.ExitStatus(err); got != tt.want {
+				t.Errorf("ExitStatus(err) = %d, want %d", got, tt.want)
+			}
+			if got := result.Status(); got != tt.want {
+				t.Errorf("Status() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
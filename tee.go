@@ -0,0 +1,179 @@
+package yup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/yupsh/framework/opt"
+)
+
+// TeeFlags controls how Tee feeds its branches
+type TeeFlags struct {
+	SlowBranch   SlowBranchPolicy // What to do when a branch falls behind
+	BranchBuffer int              // Per-branch buffer size (default: DefaultBufferSize)
+}
+
+// SlowBranchPolicy decides what Tee does when a branch's buffer is full
+type SlowBranchPolicy int
+
+const (
+	BlockSlow SlowBranchPolicy = iota // Wait for the branch, holding back every other branch
+	DropSlow                          // Drop lines the branch has no room for
+	SpillSlow                         // Overflow the branch's buffer to a temporary file
+)
+
+// BranchBuffer sets the capacity in bytes of each branch's buffer
+type BranchBuffer int
+
+func (p SlowBranchPolicy) Configure(flags *TeeFlags) { flags.SlowBranch = p }
+func (b BranchBuffer) Configure(flags *TeeFlags)     { flags.BranchBuffer = int(b) }
+
+// tee duplicates its input to several commands running concurrently
+type tee struct {
+	branches []Command
+	flags    TeeFlags
+}
+
+// Tee creates a command that copies its stdin to every branch, like
+// `tee >(a) >(b) | c` without the passthrough: pass Commands (or Pipelines)
+// as branches and TeeFlags switches to configure it. Branches share Tee's
+// stdout and stderr.
+func Tee(parameters ...any) Command {
+	args := opt.Args[Command, TeeFlags](parameters...)
+	return &tee{branches: args.Positional, flags: args.Flags}
+}
+
+// teeBranch is the write end feeding one branch
+type teeBranch struct {
+	pipe    *ringPipe
+	dropped int64
+	done    bool
+}
+
+func (t *tee) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(t.branches) == 0 {
+		_, err := CopyWithContext(ctx, io.Discard, stdin)
+		return err
+	}
+
+	// Branches are fan-out stages: they must all be live at once
+	ctx, release, err := acquireFanOut(ctx, len(t.branches))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	stdout = &lockedWriter{w: stdout}
+	stderr = &lockedWriter{w: stderr}
+
+	// Chunks are read no larger than a branch's buffer, so that a branch
+	// with an empty buffer always has room for the next one
+	size := t.flags.BranchBuffer
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	reader := bufio.NewReaderSize(stdin, min(size, 32*1024))
+	size = max(size, reader.Size())
+
+	feeds := make([]*teeBranch, len(t.branches))
+	errs := make([]error, len(t.branches))
+	var wg sync.WaitGroup
+	for i, branch := range t.branches {
+		feed := &teeBranch{pipe: newRingPipe(size, t.flags.SlowBranch == SpillSlow)}
+		feeds[i] = feed
+		wg.Add(1)
+		go func(i int, branch Command) {
+			defer wg.Done()
+			errs[i] = branch.Execute(ctx, ringPipeReader{feed.pipe}, stdout, stderr)
+			// Let the feeding loop know this branch stopped reading
+			feed.pipe.closeRead(ErrBrokenPipe)
+		}(i, branch)
+	}
+
+	readErr := t.feed(ctx, reader, feeds)
+	for _, feed := range feeds {
+		feed.pipe.closeWrite(readErr)
+	}
+	wg.Wait()
+
+	for i, feed := range feeds {
+		if feed.dropped > 0 {
+			ErrorF(stderr, "tee", "", fmt.Errorf("branch %d: dropped %d bytes", i, feed.dropped))
+		}
+	}
+
+	if readErr != nil {
+		return readErr
+	}
+	return rightmostError(errs)
+}
+
+// feed copies stdin to every live branch one line (or buffer-full) at a
+// time until stdin ends or no branch is reading any more
+func (t *tee) feed(ctx context.Context, reader *bufio.Reader, feeds []*teeBranch) error {
+	live := len(feeds)
+	for live > 0 {
+		if err := CheckContextCancellation(ctx); err != nil {
+			return err
+		}
+
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			for _, feed := range feeds {
+				if feed.done {
+					continue
+				}
+				if werr := t.write(feed, chunk); werr != nil {
+					feed.done = true
+					live--
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tee) write(feed *teeBranch, chunk []byte) error {
+	if t.flags.SlowBranch == DropSlow {
+		ok, err := feed.pipe.tryWrite(chunk)
+		if err == nil && !ok {
+			feed.dropped += int64(len(chunk))
+		}
+		return err
+	}
+	_, err := feed.pipe.write(chunk)
+	return err
+}
+
+// Describe renders the branches as process substitutions
+func (t *tee) Describe() string {
+	words := []string{"tee"}
+	for _, branch := range t.branches {
+		words = append(words, ">("+Describe(branch)+")")
+	}
+	words = append(words, ">/dev/null")
+	return strings.Join(words, " ")
+}
+
+// lockedWriter serializes writes from concurrent branches
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
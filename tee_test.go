@@ -0,0 +1,116 @@
+package yup_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	yup "github.com/yupsh/framework"
+)
+
+// collect records everything a branch reads
+type collect struct {
+	mu   sync.Mutex
+	data bytes.Buffer
+}
+
+func (c *collect) Execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	data, err := io.ReadAll(stdin)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data.Write(data)
+	return err
+}
+
+func TestTee(t *testing.T) {
+	input := strings.Repeat("some line of input\n", 2000)
+
+	t.Run("every branch sees everything", func(t *testing.T) {
+		a, b := &collect{}, &collect{}
+		var output strings.Builder
+		err := yup.Pipe(passthrough, yup.Tee(a, yup.Pipe(passthrough, b), yup.Pipe(passthrough, head(1)))).
+			Execute(context.Background(), strings.NewReader(input), &output, io.Discard)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if a.data.String() != input || b.data.String() != input {
+			t.Errorf("Branches saw %d and %d bytes, want %d", a.data.Len(), b.data.Len(), len(input))
+		}
+		if output.String() != "some line of input\n" {
+			t.Errorf("Expected head output, got %q", output.String())
+		}
+	})
+
+	slow := func(release <-chan struct{}) yup.Command {
+		return cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			<-release
+			n, err := io.Copy(io.Discard, stdin)
+			_, _ = fmt.Fprintf(stdout, "%d\n", n)
+			return err
+		})
+	}
+
+	for _, tt := range []struct {
+		name   string
+		policy yup.SlowBranchPolicy
+	}{
+		{"drop", yup.DropSlow},
+		{"spill", yup.SpillSlow},
+	} {
+		t.Run(tt.name+" keeps fast branches moving", func(t *testing.T) {
+			fastDone := make(chan int)
+			fast := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+				n, err := io.Copy(io.Discard, stdin)
+				fastDone <- int(n)
+				return err
+			})
+			release := make(chan struct{})
+			var output, stderr strings.Builder
+			done := make(chan error, 1)
+			go func() {
+				done <- yup.Tee(fast, slow(release), tt.policy, yup.BranchBuffer(1024)).
+					Execute(context.Background(), strings.NewReader(input), &output, &stderr)
+			}()
+
+			// The fast branch must finish while the slow one is still stalled
+			var fastRead int
+			select {
+			case fastRead = <-fastDone:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Fast branch was held back by the slow branch")
+			}
+			close(release)
+			if err := <-done; err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tt.policy == yup.SpillSlow {
+				if fastRead != len(input) || output.String() != fmt.Sprintf("%d\n", len(input)) {
+					t.Errorf("Branches saw %d and %q bytes, want %d", fastRead, output.String(), len(input))
+				}
+			}
+			if tt.policy == yup.DropSlow && !strings.Contains(stderr.String(), "dropped") {
+				t.Errorf("Expected a drop report, got %q", stderr.String())
+			}
+		})
+	}
+	t.Run("drop keeps lines longer than the buffer", func(t *testing.T) {
+		long := strings.Repeat("x", 100)
+		branch := &collect{}
+		var stderr strings.Builder
+		err := yup.Tee(branch, yup.DropSlow, yup.BranchBuffer(64)).
+			Execute(context.Background(), strings.NewReader(long), io.Discard, &stderr)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// The first buffer-full always fits the idle branch
+		if !strings.HasPrefix(branch.data.String(), long[:64]) {
+			t.Errorf("Expected the branch to see the line, got %q (%s)", branch.data.String(), stderr.String())
+		}
+	})
+}
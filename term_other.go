@@ -0,0 +1,16 @@
+//go:build !linux
+
+package yup
+
+import "errors"
+
+// isTerminal reports whether fd refers to a terminal; without termios
+// support every input is treated as a plain stream
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+// makeRaw is only implemented for Linux
+func makeRaw(fd uintptr) (func() error, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
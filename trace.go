@@ -0,0 +1,162 @@
+package yup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceWriter sends Verbose trace lines to a writer instead of stderr
+type TraceWriter struct{ io.Writer }
+
+// TraceLogger sends Verbose trace events to a structured logger instead of stderr
+type TraceLogger struct{ *slog.Logger }
+
+func (t TraceWriter) Configure(flags *ExecutionFlags) { flags.TraceWriter = t.Writer }
+func (t TraceLogger) Configure(flags *ExecutionFlags) { flags.TraceLogger = t.Logger }
+
+// StageStats reports the I/O a stage performed
+type StageStats struct {
+	BytesRead    int64
+	LinesRead    int64
+	BytesWritten int64
+	LinesWritten int64
+}
+
+// tracer emits a set -x style line when a stage starts and finishes
+type tracer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	logger *slog.Logger
+}
+
+func newTracer(flags ExecutionFlags, stderr io.Writer) *tracer {
+	if !flags.Verbose {
+		return nil
+	}
+	t := &tracer{w: flags.TraceWriter, logger: flags.TraceLogger}
+	if t.w == nil && t.logger == nil {
+		t.w = stderr
+	}
+	return t
+}
+
+// run executes cmd as stage index, tracing it when t is not nil and
+// counting its I/O into counters when they are given
+func (t *tracer) run(ctx context.Context, index int, cmd Command, stdin io.Reader, stdout, stderr io.Writer, counters *stageCounters) error {
+	if t == nil && counters == nil {
+		return cmd.Execute(ctx, stdin, stdout, stderr)
+	}
+	if counters == nil {
+		counters = &stageCounters{}
+	}
+	// A missing stdin has nothing to count, and a file is handed to
+	// external processes as it is, so neither is wrapped
+	in := stdin
+	switch stdin.(type) {
+	case nil, *os.File:
+	default:
+		in = &countingReader{r: stdin, c: counters}
+	}
+	out := &countingWriter{w: stdout, c: counters}
+
+	if t == nil {
+		return cmd.Execute(ctx, in, out, stderr)
+	}
+
+	desc := Describe(cmd)
+	t.start(ctx, index, desc)
+	start := time.Now()
+	err := cmd.Execute(ctx, in, out, stderr)
+	t.done(ctx, index, desc, time.Since(start), counters.snapshot(), err)
+	return err
+}
+
+func (t *tracer) start(ctx context.Context, index int, desc string) {
+	if t.logger != nil {
+		t.logger.InfoContext(ctx, "stage start", "stage", index, "command", desc)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = fmt.Fprintf(t.w, "+ [%d] %s\n", index, desc)
+}
+
+func (t *tracer) done(ctx context.Context, index int, desc string, elapsed time.Duration, stats StageStats, err error) {
+	if t.logger != nil {
+		level := slog.LevelInfo
+		if err != nil {
+			level = slog.LevelError
+		}
+		t.logger.Log(ctx, level, "stage done",
+			"stage", index,
+			"command", desc,
+			"duration", elapsed,
+			"bytes_read", stats.BytesRead,
+			"lines_read", stats.LinesRead,
+			"bytes_written", stats.BytesWritten,
+			"lines_written", stats.LinesWritten,
+			"error", err,
+		)
+		return
+	}
+
+	result := "ok"
+	if err != nil {
+		result = "error: " + err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = fmt.Fprintf(t.w, "+ [%d] %s: %s, read %d bytes (%d lines), wrote %d bytes (%d lines), %s\n",
+		index, desc, elapsed.Round(time.Microsecond),
+		stats.BytesRead, stats.LinesRead, stats.BytesWritten, stats.LinesWritten, result)
+}
+
+// stageCounters accumulates the I/O of a running stage
+type stageCounters struct {
+	bytesRead    atomic.Int64
+	linesRead    atomic.Int64
+	bytesWritten atomic.Int64
+	linesWritten atomic.Int64
+}
+
+func (c *stageCounters) snapshot() StageStats {
+	return StageStats{
+		BytesRead:    c.bytesRead.Load(),
+		LinesRead:    c.linesRead.Load(),
+		BytesWritten: c.bytesWritten.Load(),
+		LinesWritten: c.linesWritten.Load(),
+	}
+}
+
+// countingReader counts the bytes and newlines read through it
+type countingReader struct {
+	r io.Reader
+	c *stageCounters
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.c.bytesRead.Add(int64(n))
+	c.c.linesRead.Add(int64(bytes.Count(p[:n], []byte{'\n'})))
+	return n, err
+}
+
+// countingWriter counts the bytes and newlines written through it
+type countingWriter struct {
+	w io.Writer
+	c *stageCounters
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.c.bytesWritten.Add(int64(n))
+	c.c.linesWritten.Add(int64(bytes.Count(p[:n], []byte{'\n'})))
+	return n, err
+}
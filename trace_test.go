@@ -0,0 +1,63 @@
+package yup_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	yup "github.com/yupsh/framework"
+)
+
+func TestVerboseTrace(t *testing.T) {
+	failing := cmdFunc(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		_, _ = io.Copy(io.Discard, stdin)
+		return errors.New("boom")
+	})
+
+	t.Run("trace lines", func(t *testing.T) {
+		var trace bytes.Buffer
+		_ = yup.Pipe(passthrough, failing).
+			WithFlags(yup.Verbose, yup.TraceWriter{Writer: &trace}).
+			Execute(context.Background(), strings.NewReader("a\nb\n"), io.Discard, io.Discard)
+
+		lines := strings.Split(strings.TrimSpace(trace.String()), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("Expected 4 trace lines, got %d: %q", len(lines), trace.String())
+		}
+		var sawCopy, sawFailure bool
+		for _, line := range lines {
+			if strings.HasPrefix(line, "+ [0] ") && strings.HasSuffix(line, "read 4 bytes (2 lines), wrote 4 bytes (2 lines), ok") {
+				sawCopy = true
+			}
+			if strings.HasPrefix(line, "+ [1] ") && strings.HasSuffix(line, "error: boom") {
+				sawFailure = true
+			}
+		}
+		if !sawCopy || !sawFailure {
+			t.Errorf("Missing finish lines in trace: %q", trace.String())
+		}
+	})
+
+	t.Run("structured logger", func(t *testing.T) {
+		var logs bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&logs, nil))
+		var stderr bytes.Buffer
+		_ = yup.Pipe(passthrough, failing).
+			WithFlags(yup.Verbose, yup.TraceLogger{Logger: logger}).
+			Execute(context.Background(), strings.NewReader("a\n"), io.Discard, &stderr)
+
+		if got := strings.Count(logs.String(), `"msg":"stage done"`); got != 2 {
+			t.Errorf("Expected 2 stage done events, got %d", got)
+		}
+		if !strings.Contains(logs.String(), `"level":"ERROR"`) {
+			t.Errorf("Expected failing stage logged at error level: %s", logs.String())
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("Expected nothing on stderr, got %q", stderr.String())
+		}
+	})
+}
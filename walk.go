@@ -0,0 +1,260 @@
+package yup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// ErrIsDirectory is the error for reading a directory as a file
+var ErrIsDirectory = errors.New("Is a directory")
+
+var errDirectoryLoop = errors.New("recursive directory loop")
+
+// Symlinks says which symbolic links a recursive walk follows
+type Symlinks int
+
+const (
+	SymlinksArgs Symlinks = iota // Follow links given as arguments and skip those found while walking (grep -r)
+	SymlinksAll                  // Follow every link (grep -R)
+)
+
+// WalkOptions controls how FileProcessorOptions.Recursive walks directories
+type WalkOptions struct {
+	Include     []string // Process only files whose names match one of these globs
+	Exclude     []string // Skip files whose names match one of these globs
+	ExcludeDirs []string // Skip directories whose names match one of these globs
+	Symlinks    Symlinks // Which symbolic links to follow
+	MaxDepth    int      // Levels to descend below each argument; 0 for no limit
+	SkipHidden  bool     // Skip files and directories whose names start with "."
+	IgnoreFiles []string // Names of .gitignore-style files to obey, such as ".gitignore"
+}
+
+// walker visits the files below a directory argument, in name order
+type walker struct {
+	ctx     context.Context
+	options WalkOptions
+	visit   func(name string) error
+	fail    func(name string, err error) error
+}
+
+// walkFiles visits arg, or with arg a directory every file below it. The
+// names visited start with arg, as find prints them. fail reports an
+// unreadable directory or a symlink loop, and returns nil to carry on.
+func walkFiles(ctx context.Context, arg string, options WalkOptions, visit func(string) error, fail func(string, error) error) error {
+	if arg == "-" {
+		return visit(arg)
+	}
+	info, err := Stat(ctx, arg)
+	if err != nil || !info.IsDir() {
+		return visit(arg)
+	}
+	w := &walker{ctx: ctx, options: options, visit: visit, fail: fail}
+	return w.dir(arg, "", 1, nil, []fs.FileInfo{info})
+}
+
+// dir walks the directory name, which is rel below the argument. rules are
+// the ignore rules in force and ancestors the directories above, to catch
+// symlink loops.
+func (w *walker) dir(name, rel string, depth int, rules []ignoreRule, ancestors []fs.FileInfo) error {
+	entries, err := ReadDir(w.ctx, name)
+	if err != nil {
+		return w.fail(name, err)
+	}
+	rules = w.loadIgnoreFiles(name, rel, rules)
+
+	for _, entry := range entries {
+		if err := CheckContextCancellation(w.ctx); err != nil {
+			return err
+		}
+		base := entry.Name()
+		path, entryRel := joinGlob(name, base), joinGlob(rel, base)
+		if w.options.SkipHidden && strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		isDir := entry.IsDir()
+		var info fs.FileInfo
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if w.options.Symlinks != SymlinksAll {
+				continue
+			}
+			if info, err = Stat(w.ctx, path); err != nil {
+				if err := w.fail(path, err); err != nil {
+					return err
+				}
+				continue
+			}
+			isDir = info.IsDir()
+		}
+
+		if ignored(rules, entryRel, isDir) {
+			continue
+		}
+		if !isDir {
+			if w.selected(base) {
+				if err := w.visit(path); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if matchAny(w.options.ExcludeDirs, base) || w.options.MaxDepth > 0 && depth >= w.options.MaxDepth {
+			continue
+		}
+		if info == nil {
+			if info, err = entry.Info(); err != nil {
+				continue
+			}
+		}
+		if loops(ancestors, info) {
+			if err := w.fail(path, errDirectoryLoop); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.dir(path, entryRel, depth+1, rules, append(ancestors, info)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selected applies Include and Exclude to a file name
+func (w *walker) selected(base string) bool {
+	if len(w.options.Include) > 0 && !matchAny(w.options.Include, base) {
+		return false
+	}
+	return !matchAny(w.options.Exclude, base)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchFrom(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// loops reports whether info is one of the directories above it
+func loops(ancestors []fs.FileInfo, info fs.FileInfo) bool {
+	for _, ancestor := range ancestors {
+		if os.SameFile(ancestor, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreRule is one pattern of an ignore file, in the syntax of .gitignore
+type ignoreRule struct {
+	base     string   // directory of the ignore file, below the argument
+	segments []string // pattern split at slashes
+	anchored bool     // matches from base rather than at any depth
+	dirOnly  bool     // matches directories only
+	negate   bool     // re-includes what earlier rules excluded
+}
+
+// loadIgnoreFiles adds the rules of the ignore files in a directory
+func (w *walker) loadIgnoreFiles(dir, rel string, rules []ignoreRule) []ignoreRule {
+	if len(w.options.IgnoreFiles) == 0 {
+		return rules
+	}
+	// Copy, so that sibling directories do not share appended rules
+	rules = append([]ignoreRule(nil), rules...)
+	for _, name := range w.options.IgnoreFiles {
+		file, err := Open(w.ctx, joinGlob(dir, name))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(rel, scanner.Text()); ok {
+				rules = append(rules, rule)
+			}
+		}
+		_ = file.Close()
+	}
+	return rules
+}
+
+// parseIgnoreRule parses one line of an ignore file
+func parseIgnoreRule(base, line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate, line = true, line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	rule.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// ignored applies the rules to a path below the argument; the last rule
+// that matches decides
+func ignored(rules []ignoreRule, rel string, isDir bool) bool {
+	ignore := false
+	for _, rule := range rules {
+		if rule.matches(rel, isDir) {
+			ignore = !rule.negate
+		}
+	}
+	return ignore
+}
+
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	segments := strings.Split(rel, "/")
+	if !r.anchored {
+		return matchFrom(r.segments[0], segments[len(segments)-1])
+	}
+	return matchSegments(r.segments, segments)
+}
+
+// matchSegments matches a path against a pattern segment by segment, with
+// "**" matching any number of segments
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(path); i >= 0; i-- {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if !matchFrom(pattern[0], path[0]) {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
@@ -0,0 +1,129 @@
+package yup_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	yup "github.com/yupsh/framework"
+)
+
+var walkFS = fstest.MapFS{
+	"src/.env":           {},
+	"src/.gitignore":     {Data: []byte("# build output\nbuild/\n*.txt\n!keep.txt\n")},
+	"src/a.go":           {},
+	"src/b.txt":          {},
+	"src/build/out.go":   {},
+	"src/keep.txt":       {},
+	"src/lib/.gitignore": {Data: []byte("/deep\n")},
+	"src/lib/c.go":       {},
+	"src/lib/deep/d.go":  {},
+	"src/vendor/v.go":    {},
+	"top.go":             {},
+}
+
+// walked runs ProcessFilesWithContext and returns the names it processed
+func walked(ctx context.Context, args []string, options yup.FileProcessorOptions) ([]string, string) {
+	var output, stderr strings.Builder
+	options.CommandName = "cat"
+	_ = yup.ProcessFilesWithContext(ctx, args, nil, &output, &stderr, options,
+		func(ctx context.Context, source yup.InputSource, output io.Writer) error {
+			_, err := fmt.Fprintln(output, source.Filename)
+			return err
+		})
+	return strings.Fields(output.String()), stderr.String()
+}
+
+func TestProcessFilesRecursive(t *testing.T) {
+	ctx := yup.WithFS(context.Background(), walkFS)
+	tests := []struct {
+		name       string
+		args       []string
+		walk       yup.WalkOptions
+		want       string
+		wantStderr string
+	}{
+		{"everything", []string{"src", "top.go"}, yup.WalkOptions{},
+			"src/.env src/.gitignore src/a.go src/b.txt src/build/out.go src/keep.txt src/lib/.gitignore src/lib/c.go src/lib/deep/d.go src/vendor/v.go top.go", ""},
+		{"include", []string{"src"}, yup.WalkOptions{Include: []string{"*.go"}},
+			"src/a.go src/build/out.go src/lib/c.go src/lib/deep/d.go src/vendor/v.go", ""},
+		{"exclude", []string{"src"}, yup.WalkOptions{Exclude: []string{"*.go", ".*"}},
+			"src/b.txt src/keep.txt", ""},
+		{"exclude directories", []string{"src"}, yup.WalkOptions{ExcludeDirs: []string{"vendor", "b*"}, Include: []string{"*.go"}},
+			"src/a.go src/lib/c.go src/lib/deep/d.go", ""},
+		{"depth", []string{"src"}, yup.WalkOptions{MaxDepth: 1, SkipHidden: true},
+			"src/a.go src/b.txt src/keep.txt", ""},
+		{"depth two", []string{"src/lib"}, yup.WalkOptions{MaxDepth: 2, SkipHidden: true},
+			"src/lib/c.go src/lib/deep/d.go", ""},
+		{"ignore files", []string{"src"}, yup.WalkOptions{IgnoreFiles: []string{".gitignore"}, SkipHidden: true},
+			"src/a.go src/keep.txt src/lib/c.go src/vendor/v.go", ""},
+		{"ignore files below the argument", []string{"src/lib"}, yup.WalkOptions{IgnoreFiles: []string{".gitignore"}, SkipHidden: true},
+			"src/lib/c.go", ""},
+		{"missing argument", []string{"nosuch", "top.go"}, yup.WalkOptions{},
+			"top.go", "cat: nosuch: open nosuch: file does not exist\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stderr := walked(ctx, tt.args, yup.FileProcessorOptions{Recursive: true, Walk: tt.walk, ContinueOnError: true})
+			if strings.Join(got, " ") != tt.want || stderr != tt.wantStderr {
+				t.Errorf("Got %q, stderr %q, want %q, %q", got, stderr, tt.want, tt.wantStderr)
+			}
+		})
+	}
+
+	t.Run("is a directory", func(t *testing.T) {
+		got, stderr := walked(ctx, []string{"src", "top.go"}, yup.FileProcessorOptions{ContinueOnError: true})
+		if strings.Join(got, " ") != "top.go" || stderr != "cat: src: Is a directory\n" {
+			t.Errorf("Got %q, stderr %q", got, stderr)
+		}
+	})
+
+	t.Run("headers", func(t *testing.T) {
+		var output strings.Builder
+		options := yup.FileProcessorOptions{Recursive: true, ShowHeaders: true, Walk: yup.WalkOptions{Include: []string{"c.go", "d.go"}}}
+		_ = yup.ProcessFilesWithContext(ctx, []string{"src/lib"}, nil, &output, io.Discard, options,
+			func(context.Context, yup.InputSource, io.Writer) error { return nil })
+		if want := "==> src/lib/c.go <==\n==> src/lib/deep/d.go <==\n"; output.String() != want {
+			t.Errorf("Got %q, want %q", output.String(), want)
+		}
+	})
+}
+
+func TestProcessFilesSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "tree", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tree", "a.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "outside.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"tree/sub/loop": "..", "tree/file": "../outside.txt", "link": "tree"} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skip("needs symlinks:", err)
+		}
+	}
+	ctx := yup.WithEnv(context.Background(), &yup.Env{Dir: dir})
+
+	t.Run("arguments only", func(t *testing.T) {
+		got, stderr := walked(ctx, []string{"link"}, yup.FileProcessorOptions{Recursive: true})
+		if strings.Join(got, " ") != "link/a.txt" || stderr != "" {
+			t.Errorf("Got %q, stderr %q", got, stderr)
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		options := yup.FileProcessorOptions{Recursive: true, ContinueOnError: true, Walk: yup.WalkOptions{Symlinks: yup.SymlinksAll}}
+		got, stderr := walked(ctx, []string{"tree"}, options)
+		if strings.Join(got, " ") != "tree/a.txt tree/file" || stderr != "cat: tree/sub/loop: recursive directory loop\n" {
+			t.Errorf("Got %q, stderr %q", got, stderr)
+		}
+	})
+}